@@ -5,6 +5,37 @@ import "strings"
 type Clause struct {
 	sql     map[Type]string
 	sqlVars map[Type][]interface{}
+	conds   map[Type]Condition // of WHERE and HAVING
+	joins   []interface{}
+	dialect Dialect
+}
+
+// Dialect is the part of dialect.Dialect the generators depend on.
+type Dialect interface {
+	BindVar(n int) string
+	Quote(identifier string) string
+}
+
+// New returns a Clause whose built SQL quotes identifiers and uses bind vars
+// the way d does, e.g. "$1, $2" instead of "?" for PostgreSQL. The zero
+// Clause leaves identifiers as they are and uses "?".
+func New(d Dialect) Clause {
+	return Clause{dialect: d}
+}
+
+// Quote quotes a table or column name, each part of "table.column" is
+// quoted on its own. "*" and expressions such as "count(*)" are kept as is.
+func (c *Clause) Quote(name string) string {
+	if c.dialect == nil || name == "*" || strings.ContainsAny(name, " ()") {
+		return name
+	}
+	parts := strings.Split(name, ".")
+	for i, part := range parts {
+		if part != "*" {
+			parts[i] = c.dialect.Quote(part)
+		}
+	}
+	return strings.Join(parts, ".")
 }
 
 type Type int
@@ -19,18 +50,59 @@ const (
 	UPDATE
 	DELETE
 	COUNT
+	GROUPBY
+	HAVING
+	JOIN
+	OFFSET
 )
 
 func (c *Clause) Set(name Type, vars ...interface{}) {
 	if c.sql == nil {
 		c.sql = make(map[Type]string)
 		c.sqlVars = make(map[Type][]interface{})
+		c.conds = make(map[Type]Condition)
+	}
+	if name == WHERE || name == HAVING {
+		c.conds[name] = whereCondition(vars...)
 	}
-	sql, vars := generators[name](vars...)
+	sql, vars := generators[name](c.Quote, vars...)
 	c.sql[name] = sql
 	c.sqlVars[name] = vars
 }
 
+// AndWhere adds cond to the WHERE clause with AND.
+func (c *Clause) AndWhere(cond Condition) {
+	if where := And(c.conds[WHERE], cond); where != nil {
+		c.Set(WHERE, where)
+	}
+}
+
+// OrWhere adds cond to the WHERE clause with OR.
+func (c *Clause) OrWhere(cond Condition) {
+	if where := Or(c.conds[WHERE], cond); where != nil {
+		c.Set(WHERE, where)
+	}
+}
+
+// AddJoin appends a join to the JOIN clause.
+func (c *Clause) AddJoin(join Join) {
+	c.joins = append(c.joins, join)
+	c.Set(JOIN, c.joins...)
+}
+
+// Has reports whether the clause type has been set.
+func (c *Clause) Has(name Type) bool {
+	_, ok := c.sql[name]
+	return ok
+}
+
+// AndHaving adds cond to the HAVING clause with AND.
+func (c *Clause) AndHaving(cond Condition) {
+	if having := And(c.conds[HAVING], cond); having != nil {
+		c.Set(HAVING, having)
+	}
+}
+
 func (c *Clause) Build(orders ...Type) (string, []interface{}) {
 	var sqls []string
 	var vars []interface{}
@@ -41,5 +113,33 @@ func (c *Clause) Build(orders ...Type) (string, []interface{}) {
 			vars = append(vars, c.sqlVars[order]...)
 		}
 	}
-	return strings.Join(sqls, " "), vars
+	return c.rebind(strings.Join(sqls, " ")), vars
+}
+
+// rebind replaces the "?" placeholders outside of quoted strings and
+// identifiers with the bind vars of the dialect.
+func (c *Clause) rebind(sql string) string {
+	if c.dialect == nil {
+		return sql
+	}
+
+	var b strings.Builder
+	var quote rune
+	n := 0
+	for _, r := range sql {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"' || r == '`':
+			quote = r
+		case r == '?':
+			n++
+			b.WriteString(c.dialect.BindVar(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
 }
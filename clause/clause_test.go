@@ -21,8 +21,116 @@ func testSelect(t *testing.T) {
 	}
 }
 
+func testWhere(t *testing.T) {
+	var clause Clause
+	clause.Set(SELECT, "User", []string{"*"})
+	clause.AndWhere(Expr("Age > ?", 18))
+	clause.AndWhere(Expr("Name = ?", "Tom"))
+	clause.OrWhere(And(Expr("Name = ?", "Sam"), Not(Expr("Age IN (?, ?)", 1, 2))))
+	sql, vars := clause.Build(SELECT, WHERE)
+	t.Log(sql, vars)
+	if sql != "SELECT * FROM User WHERE ((Age > ?) AND (Name = ?)) OR ((Name = ?) AND (NOT (Age IN (?, ?))))" {
+		t.Fatal("failed to build SQL")
+	}
+	if !reflect.DeepEqual(vars, []interface{}{18, "Tom", "Sam", 1, 2}) {
+		t.Fatal("failed to build SQLVars")
+	}
+
+	clause.Set(WHERE, "Name = ?", "Jack")
+	clause.AndWhere(Expr("Age = ?", 20))
+	sql, vars = clause.Build(WHERE)
+	if sql != "WHERE (Name = ?) AND (Age = ?)" || !reflect.DeepEqual(vars, []interface{}{"Jack", 20}) {
+		t.Fatal("failed to add condition after Set, got", sql, vars)
+	}
+}
+
 func TestClause_Build(t *testing.T) {
 	t.Run("select", func(t *testing.T) {
 		testSelect(t)
 	})
+	t.Run("where", func(t *testing.T) {
+		testWhere(t)
+	})
+}
+
+type backtick struct{}
+
+func (backtick) BindVar(n int) string { return "?" }
+func (backtick) Quote(identifier string) string {
+	return "`" + identifier + "`"
+}
+
+func TestClause_Quote(t *testing.T) {
+	clause := New(backtick{})
+	tests := map[string]string{
+		"Order":       "`Order`",
+		"Order.Group": "`Order`.`Group`",
+		"Order.*":     "`Order`.*",
+		"*":           "*",
+		"count(*)":    "count(*)",
+	}
+	for name, want := range tests {
+		if got := clause.Quote(name); got != want {
+			t.Fatalf("Quote(%q) = %q, want %q", name, got, want)
+		}
+	}
+
+	clause.Set(UPDATE, "Order", map[string]interface{}{"Select": 1, "Group": "a"})
+	sql, vars := clause.Build(UPDATE)
+	if sql != "UPDATE `Order` SET `Group` = ?, `Select` = ?" || !reflect.DeepEqual(vars, []interface{}{"a", 1}) {
+		t.Fatal("failed to build update, got", sql, vars)
+	}
+}
+
+func TestClause_GroupBy(t *testing.T) {
+	var clause Clause
+	clause.Set(SELECT, "Order", []string{"Customer", "SUM(Total)"})
+	clause.Set(GROUPBY, []string{"Customer"})
+	clause.AndHaving(Expr("SUM(Total) > ?", 100))
+	clause.AndHaving(Expr("COUNT(*) > ?", 1))
+	sql, vars := clause.Build(SELECT, WHERE, GROUPBY, HAVING)
+	if sql != "SELECT Customer, SUM(Total) FROM Order GROUP BY Customer HAVING (SUM(Total) > ?) AND (COUNT(*) > ?)" {
+		t.Fatal("failed to build SQL, got", sql)
+	}
+	if !reflect.DeepEqual(vars, []interface{}{100, 1}) {
+		t.Fatal("failed to build SQLVars")
+	}
+}
+
+func TestClause_Join(t *testing.T) {
+	clause := New(backtick{})
+	clause.Set(SELECT, "User", []string{"User.*"})
+	clause.AddJoin(Join{Kind: "JOIN", Table: "Order", On: Expr("`Order`.`UserID` = `User`.`ID`")})
+	clause.AddJoin(Join{Kind: "LEFT JOIN", Table: "Address", On: Expr("`Address`.`UserID` = `User`.`ID` AND `Address`.`City` = ?", "Paris")})
+	clause.AndWhere(Expr("`Order`.`Total` > ?", 100))
+	sql, vars := clause.Build(SELECT, JOIN, WHERE)
+	want := "SELECT `User`.* FROM `User` JOIN `Order` ON `Order`.`UserID` = `User`.`ID` " +
+		"LEFT JOIN `Address` ON `Address`.`UserID` = `User`.`ID` AND `Address`.`City` = ? WHERE `Order`.`Total` > ?"
+	if sql != want || !reflect.DeepEqual(vars, []interface{}{"Paris", 100}) {
+		t.Fatal("failed to build join, got", sql, vars)
+	}
+}
+
+func TestClause_Offset(t *testing.T) {
+	var clause Clause
+	clause.Set(SELECT, "User", []string{"*"})
+	clause.Set(LIMIT, 10)
+	clause.Set(OFFSET, 20)
+	sql, vars := clause.Build(SELECT, LIMIT, OFFSET)
+	if sql != "SELECT * FROM User LIMIT ? OFFSET ?" || !reflect.DeepEqual(vars, []interface{}{10, 20}) {
+		t.Fatal("failed to build offset, got", sql, vars)
+	}
+}
+
+func TestClause_In(t *testing.T) {
+	var clause Clause
+	clause.AndWhere(In("UserID", 1, 2, 3))
+	sql, vars := clause.Build(WHERE)
+	if sql != "WHERE UserID IN (?, ?, ?)" || !reflect.DeepEqual(vars, []interface{}{1, 2, 3}) {
+		t.Fatal("failed to build IN, got", sql, vars)
+	}
+
+	if sql, vars := In("UserID").Build(); sql != "1 = 0" || len(vars) != 0 {
+		t.Fatal("expect IN of no values to be false, got", sql)
+	}
 }
@@ -0,0 +1,93 @@
+package clause
+
+import "strings"
+
+// Condition is a boolean SQL expression with its bind vars, used by WHERE.
+type Condition interface {
+	Build() (string, []interface{})
+}
+
+type expr struct {
+	sql  string
+	vars []interface{}
+}
+
+// Expr returns a plain condition such as Expr("Age > ?", 18).
+func Expr(sql string, vars ...interface{}) Condition {
+	return expr{sql: sql, vars: vars}
+}
+
+func (e expr) Build() (string, []interface{}) {
+	return e.sql, e.vars
+}
+
+type junction struct {
+	op    string
+	conds []Condition
+}
+
+// And joins the conditions with AND, nil conditions are skipped.
+func And(conds ...Condition) Condition {
+	return join("AND", conds)
+}
+
+// Or joins the conditions with OR, nil conditions are skipped.
+func Or(conds ...Condition) Condition {
+	return join("OR", conds)
+}
+
+func join(op string, conds []Condition) Condition {
+	var flat []Condition
+	for _, cond := range conds {
+		if cond == nil {
+			continue
+		}
+		// (a AND b) AND c is flattened into a AND b AND c
+		if j, ok := cond.(junction); ok && j.op == op {
+			flat = append(flat, j.conds...)
+			continue
+		}
+		flat = append(flat, cond)
+	}
+	switch len(flat) {
+	case 0:
+		return nil
+	case 1:
+		return flat[0]
+	}
+	return junction{op: op, conds: flat}
+}
+
+func (j junction) Build() (string, []interface{}) {
+	var sqls []string
+	var vars []interface{}
+	for _, cond := range j.conds {
+		sql, v := cond.Build()
+		sqls = append(sqls, "("+sql+")")
+		vars = append(vars, v...)
+	}
+	return strings.Join(sqls, " "+j.op+" "), vars
+}
+
+type not struct {
+	cond Condition
+}
+
+// Not negates the condition.
+func Not(cond Condition) Condition {
+	return not{cond: cond}
+}
+
+func (n not) Build() (string, []interface{}) {
+	sql, vars := n.cond.Build()
+	return "NOT (" + sql + ")", vars
+}
+
+// In returns the condition column IN (values...), which is false for no
+// values. column is used as is, it must be quoted by the caller if needed.
+func In(column string, values ...interface{}) Condition {
+	if len(values) == 0 {
+		return Expr("1 = 0")
+	}
+	return Expr(column+" IN (?"+strings.Repeat(", ?", len(values)-1)+")", values...)
+}
@@ -2,10 +2,13 @@ package clause
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 )
 
-type generator func(vals ...interface{}) (string, []interface{})
+// generator builds the SQL of one clause type, quote is applied to the table
+// and column names it receives.
+type generator func(quote func(string) string, vals ...interface{}) (string, []interface{})
 
 var generators map[Type]generator
 
@@ -20,6 +23,18 @@ func init() {
 	generators[UPDATE] = updateClause
 	generators[DELETE] = deleteClause
 	generators[COUNT] = countClause
+	generators[GROUPBY] = groupbyClause
+	generators[HAVING] = havingClause
+	generators[JOIN] = joinClause
+	generators[OFFSET] = offsetClause
+}
+
+func quoteAll(quote func(string) string, names []string) []string {
+	quoted := make([]string, 0, len(names))
+	for _, name := range names {
+		quoted = append(quoted, quote(name))
+	}
+	return quoted
 }
 
 func genBindVars(num int) string {
@@ -30,14 +45,14 @@ func genBindVars(num int) string {
 	return strings.Join(vars, ", ")
 }
 
-func insertClause(vals ...interface{}) (string, []interface{}) {
+func insertClause(quote func(string) string, vals ...interface{}) (string, []interface{}) {
 	// INSERT INTO $tableName ($fields)
-	tableName := vals[0]
-	fileds := strings.Join(vals[1].([]string), ",")
-	return fmt.Sprintf("INSERT INTO %v (%s)", tableName, fileds), []interface{}{}
+	tableName := quote(fmt.Sprint(vals[0]))
+	fileds := strings.Join(quoteAll(quote, vals[1].([]string)), ",")
+	return fmt.Sprintf("INSERT INTO %s (%s)", tableName, fileds), []interface{}{}
 }
 
-func valuesClause(vals ...interface{}) (string, []interface{}) {
+func valuesClause(quote func(string) string, vals ...interface{}) (string, []interface{}) {
 	// VALUES ($v1), ($v2), ...
 	var bingStr string
 	var sql strings.Builder
@@ -57,46 +72,97 @@ func valuesClause(vals ...interface{}) (string, []interface{}) {
 	return sql.String(), vars
 }
 
-func selectClause(vals ...interface{}) (string, []interface{}) {
+func selectClause(quote func(string) string, vals ...interface{}) (string, []interface{}) {
 	// SELECT $fields FROM $tableName
-	tableName := vals[0]
-	filelds := strings.Join(vals[1].([]string), ", ")
-	return fmt.Sprintf("SELECT %s FROM %v", filelds, tableName), []interface{}{}
+	tableName := quote(fmt.Sprint(vals[0]))
+	filelds := strings.Join(quoteAll(quote, vals[1].([]string)), ", ")
+	return fmt.Sprintf("SELECT %s FROM %s", filelds, tableName), []interface{}{}
 }
 
-func limitClause(vals ...interface{}) (string, []interface{}) {
+func limitClause(quote func(string) string, vals ...interface{}) (string, []interface{}) {
 	// LIMIT $num
 	return "LIMIT ?", vals
 }
 
-func whereClause(vals ...interface{}) (string, []interface{}) {
+func offsetClause(quote func(string) string, vals ...interface{}) (string, []interface{}) {
+	// OFFSET $num
+	return "OFFSET ?", vals
+}
+
+// whereCondition accepts a Condition, or a description followed by its vars.
+func whereCondition(vals ...interface{}) Condition {
+	if cond, ok := vals[0].(Condition); ok {
+		return cond
+	}
+	return Expr(fmt.Sprint(vals[0]), vals[1:]...)
+}
+
+func whereClause(quote func(string) string, vals ...interface{}) (string, []interface{}) {
 	// WHERE $exp
-	desc, vars := vals[0], vals[1:]
+	desc, vars := whereCondition(vals...).Build()
 	return fmt.Sprintf("WHERE %s", desc), vars
 }
 
-func orderbyClause(vals ...interface{}) (string, []interface{}) {
+func orderbyClause(quote func(string) string, vals ...interface{}) (string, []interface{}) {
 	// ORDER BY
 	return fmt.Sprintf("ORDER BY %s", vals[0]), []interface{}{}
 }
 
-func updateClause(vals ...interface{}) (string, []interface{}) {
-	tableName := vals[0]
+func updateClause(quote func(string) string, vals ...interface{}) (string, []interface{}) {
+	tableName := quote(fmt.Sprint(vals[0]))
 	m := vals[1].(map[string]interface{})
 
+	// sorted, so the same update always produces the same SQL
+	columns := make([]string, 0, len(m))
+	for k := range m {
+		columns = append(columns, k)
+	}
+	sort.Strings(columns)
+
 	var keys []string
 	var vars []interface{}
-	for k, v := range m {
-		keys = append(keys, k+" = ?")
-		vars = append(vars, v)
+	for _, k := range columns {
+		keys = append(keys, quote(k)+" = ?")
+		vars = append(vars, m[k])
 	}
-	return fmt.Sprintf("UPDATE %v SET %s", tableName, strings.Join(keys, ", ")), vars
+	return fmt.Sprintf("UPDATE %s SET %s", tableName, strings.Join(keys, ", ")), vars
 }
 
-func deleteClause(vals ...interface{}) (string, []interface{}) {
-	return fmt.Sprintf("DELETE FROM %v", vals[0]), []interface{}{}
+func deleteClause(quote func(string) string, vals ...interface{}) (string, []interface{}) {
+	return fmt.Sprintf("DELETE FROM %s", quote(fmt.Sprint(vals[0]))), []interface{}{}
 }
 
-func countClause(vals ...interface{}) (string, []interface{}) {
-	return selectClause(vals[0], []string{"count(*)"})
+func countClause(quote func(string) string, vals ...interface{}) (string, []interface{}) {
+	return selectClause(quote, vals[0], []string{"count(*)"})
+}
+
+func groupbyClause(quote func(string) string, vals ...interface{}) (string, []interface{}) {
+	// GROUP BY $fields
+	return fmt.Sprintf("GROUP BY %s", strings.Join(quoteAll(quote, vals[0].([]string)), ", ")), []interface{}{}
+}
+
+func havingClause(quote func(string) string, vals ...interface{}) (string, []interface{}) {
+	// HAVING $exp
+	desc, vars := whereCondition(vals...).Build()
+	return fmt.Sprintf("HAVING %s", desc), vars
+}
+
+// Join is one table joined by a SELECT, Kind is "JOIN", "LEFT JOIN", ...
+type Join struct {
+	Kind  string
+	Table string
+	On    Condition
+}
+
+func joinClause(quote func(string) string, vals ...interface{}) (string, []interface{}) {
+	// $kind $table ON $exp ...
+	var joins []string
+	var vars []interface{}
+	for _, val := range vals {
+		join := val.(Join)
+		on, v := join.On.Build()
+		joins = append(joins, fmt.Sprintf("%s %s ON %s", join.Kind, quote(join.Table), on))
+		vars = append(vars, v...)
+	}
+	return strings.Join(joins, " "), vars
 }
@@ -0,0 +1,68 @@
+package orm
+
+import (
+	"context"
+	"database/sql/driver"
+)
+
+// connector runs the connection statements of a dialect on every connection
+// it opens, for the settings a database keeps per connection, such as the
+// foreign keys of SQLite.
+type connector struct {
+	driver.Connector
+	stmts []string
+}
+
+func (c *connector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, stmt := range c.stmts {
+		if err := execConn(ctx, conn, stmt); err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+func execConn(ctx context.Context, conn driver.Conn, query string) error {
+	if execer, ok := conn.(driver.ExecerContext); ok {
+		_, err := execer.ExecContext(ctx, query, nil)
+		return err
+	}
+	stmt, err := conn.Prepare(query)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	_, err = stmt.Exec(nil)
+	return err
+}
+
+// dsnConnector is the connector of a driver which has none.
+type dsnConnector struct {
+	dsn    string
+	driver driver.Driver
+}
+
+func (c *dsnConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	return c.driver.Open(c.dsn)
+}
+
+func (c *dsnConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+// newConnector returns the connector of source wrapped to run stmts.
+func newConnector(d driver.Driver, source string, stmts []string) (driver.Connector, error) {
+	var base driver.Connector = &dsnConnector{dsn: source, driver: d}
+	if dc, ok := d.(driver.DriverContext); ok {
+		var err error
+		if base, err = dc.OpenConnector(source); err != nil {
+			return nil, err
+		}
+	}
+	return &connector{Connector: base, stmts: stmts}, nil
+}
@@ -1,12 +1,89 @@
 package dialect
 
-import "reflect"
+import (
+	"errors"
+	"reflect"
+	"strings"
+)
 
 var dialectsMap = map[string]Dialect{}
 
 type Dialect interface {
-	DataTypeOf(typ reflect.Value) string
+	// DataTypeOf returns the column type of typ, size is the length given
+	// by the size tag or 0. It returns "" when no column can hold typ.
+	DataTypeOf(typ reflect.Value, size int) string
 	TableExistSQL(tableName string) (string, []interface{})
+	// ColumnsSQL returns the query listing the columns of a table in table
+	// order, as rows of name, type, not null, default, primary key, unique
+	// and auto increment, with the types and defaults spelled the way
+	// DataTypeOf and the default tag spell them. Unique is a UNIQUE column
+	// constraint, unique indexes are listed by IndexesSQL.
+	ColumnsSQL(tableName string) (string, []interface{})
+	// IndexesSQL returns the query listing the indexes of a table created by
+	// CREATE INDEX, leaving out those backing a primary key or unique column
+	// constraint, as rows of name and definition in name order, with the
+	// definition spelled the way schema.Index.Definition spells it.
+	IndexesSQL(tableName string) (string, []interface{})
+	// DropIndexSQL returns the statement dropping an index of a table.
+	DropIndexSQL(tableName, indexName string) string
+	// ForeignKeysSQL returns the query listing the foreign keys of a table,
+	// as rows of column, referenced table, referenced column, ON DELETE and
+	// ON UPDATE action.
+	ForeignKeysSQL(tableName string) (string, []interface{})
+	// ReferencingTablesSQL returns the query listing the names of the other
+	// tables with a foreign key referencing a table.
+	ReferencingTablesSQL(tableName string) (string, []interface{})
+	// ForeignKeyChecks returns the statement turning the enforcement of
+	// foreign keys on or off for the connection, or "" if it cannot be.
+	ForeignKeyChecks(enable bool) string
+	// ConnectionSQL returns the statements run on every new connection, for
+	// the settings a database keeps per connection.
+	ConnectionSQL() []string
+	// BindVar returns the placeholder of the n-th (1-based) argument.
+	BindVar(n int) string
+	// Quote quotes a table or column name, so reserved words and mixed-case
+	// names can be used as identifiers.
+	Quote(identifier string) string
+	// AutoIncrement returns the column type and the keyword declaring an
+	// auto increment column whose type would otherwise be typ.
+	AutoIncrement(typ string) (string, string)
+	// ResetAutoIncrementSQL returns the statement moving the generator of
+	// the auto increment column past the keys in the table, once rows were
+	// copied with their keys, or "" when inserting the keys moves it.
+	ResetAutoIncrementSQL(tableName, column string) string
+	// Returning returns the clause appended to an INSERT to read back the
+	// generated value of column, or "" when the driver reports it through
+	// sql.Result.LastInsertId.
+	Returning(column string) string
+	// Retryable reports whether err is a transient failure, such as lock
+	// contention or a serialization failure, after which the transaction
+	// may succeed when run again.
+	Retryable(err error) bool
+}
+
+// sqlState returns the SQLSTATE code of err when the driver exposes one.
+func sqlState(err error) string {
+	var e interface{ SQLState() string }
+	if errors.As(err, &e) {
+		return e.SQLState()
+	}
+	return ""
+}
+
+// nullValue returns the zero value wrapped by a sql.Null type such as
+// sql.NullString, whose column is the column of the wrapped type.
+func nullValue(typ reflect.Value) (reflect.Value, bool) {
+	t := typ.Type()
+	if t.PkgPath() != "database/sql" || !strings.HasPrefix(t.Name(), "Null") ||
+		t.NumField() != 2 || t.Field(1).Name != "Valid" {
+		return reflect.Value{}, false
+	}
+	return reflect.Zero(t.Field(0).Type), true
+}
+
+// quoteIdent quotes an identifier the standard SQL way, with double quotes.
+func quoteIdent(identifier string) string {
+	return `"` + strings.ReplaceAll(identifier, `"`, `""`) + `"`
 }
 
 func RegisterDialect(name string, dialect Dialect) {
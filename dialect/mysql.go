@@ -0,0 +1,160 @@
+package dialect
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+type mysql struct{}
+
+func init() {
+	RegisterDialect("mysql", &mysql{})
+}
+
+func (m *mysql) DataTypeOf(typ reflect.Value, size int) string {
+	switch typ.Kind() {
+	case reflect.Ptr:
+		// a nil pointer is NULL
+		return m.DataTypeOf(reflect.Zero(typ.Type().Elem()), size)
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int8:
+		return "tinyint"
+	case reflect.Int16:
+		return "smallint"
+	case reflect.Int, reflect.Int32:
+		return "int"
+	case reflect.Int64:
+		return "bigint"
+	case reflect.Uint8:
+		return "tinyint unsigned"
+	case reflect.Uint16:
+		return "smallint unsigned"
+	case reflect.Uint, reflect.Uint32:
+		return "int unsigned"
+	case reflect.Uint64:
+		return "bigint unsigned"
+	case reflect.Float32:
+		return "float"
+	case reflect.Float64:
+		return "double"
+	case reflect.String:
+		if size == 0 {
+			size = 255
+		}
+		return fmt.Sprintf("varchar(%d)", size)
+	case reflect.Array, reflect.Slice:
+		if size > 0 {
+			return fmt.Sprintf("varbinary(%d)", size)
+		}
+		return "longblob"
+	case reflect.Struct:
+		if _, ok := typ.Interface().(time.Time); ok {
+			return "datetime"
+		}
+		if v, ok := nullValue(typ); ok {
+			return m.DataTypeOf(v, size)
+		}
+	}
+	return ""
+}
+
+func (m *mysql) TableExistSQL(tableName string) (string, []interface{}) {
+	args := []interface{}{tableName}
+	return "SELECT table_name FROM information_schema.tables WHERE table_schema = DATABASE() AND table_name = ?", args
+}
+
+// ColumnsSQL reads information_schema.columns, display widths such as
+// int(11) are dropped, tinyint(1) is boolean and string defaults are quoted.
+// A UNIQUE column is backed by a unique index named after the column.
+func (m *mysql) ColumnsSQL(tableName string) (string, []interface{}) {
+	args := []interface{}{tableName}
+	return "SELECT column_name, " +
+		"CASE WHEN column_type = 'tinyint(1)' THEN 'boolean' " +
+		"ELSE REGEXP_REPLACE(column_type, '^(tinyint|smallint|mediumint|int|bigint)\\([0-9]+\\)', '$1') END, " +
+		"is_nullable = 'NO', " +
+		"CASE WHEN column_default IS NOT NULL AND data_type IN ('char', 'varchar', 'text', 'mediumtext', 'longtext') " +
+		"THEN QUOTE(column_default) ELSE column_default END, " +
+		"column_key = 'PRI', " +
+		"EXISTS (SELECT 1 FROM information_schema.statistics s WHERE s.table_schema = c.table_schema " +
+		"AND s.table_name = c.table_name AND s.index_name = c.column_name AND s.column_name = c.column_name " +
+		"AND s.non_unique = 0), " +
+		"extra LIKE '%auto_increment%' " +
+		"FROM information_schema.columns c WHERE table_schema = DATABASE() AND table_name = ? ORDER BY ordinal_position", args
+}
+
+// IndexesSQL builds the definitions from the columns of each index, and
+// leaves out the index of a UNIQUE column, which MySQL names after the
+// column.
+func (m *mysql) IndexesSQL(tableName string) (string, []interface{}) {
+	args := []interface{}{tableName}
+	return "SELECT index_name, CONCAT(IF(MIN(non_unique) = 0, 'CREATE UNIQUE INDEX ', 'CREATE INDEX '), " +
+		"'`', REPLACE(index_name, '`', '``'), '` ON `', REPLACE(table_name, '`', '``'), '` (', " +
+		"GROUP_CONCAT(CONCAT('`', REPLACE(column_name, '`', '``'), '`') ORDER BY seq_in_index SEPARATOR ', '), ')') " +
+		"FROM information_schema.statistics " +
+		"WHERE table_schema = DATABASE() AND table_name = ? AND index_name <> 'PRIMARY' " +
+		"AND NOT (non_unique = 0 AND index_name = column_name) GROUP BY index_name, table_name ORDER BY index_name", args
+}
+
+// DropIndexSQL names the table, MySQL index names are per table.
+func (m *mysql) DropIndexSQL(tableName, indexName string) string {
+	return fmt.Sprintf("DROP INDEX %s ON %s", m.Quote(indexName), m.Quote(tableName))
+}
+
+func (m *mysql) ForeignKeysSQL(tableName string) (string, []interface{}) {
+	args := []interface{}{tableName}
+	return "SELECT k.column_name, k.referenced_table_name, k.referenced_column_name, r.delete_rule, r.update_rule " +
+		"FROM information_schema.key_column_usage k JOIN information_schema.referential_constraints r " +
+		"ON r.constraint_schema = k.constraint_schema AND r.constraint_name = k.constraint_name " +
+		"WHERE k.table_schema = DATABASE() AND k.table_name = ? AND k.referenced_table_name IS NOT NULL " +
+		"ORDER BY k.ordinal_position", args
+}
+
+func (m *mysql) ReferencingTablesSQL(tableName string) (string, []interface{}) {
+	args := []interface{}{tableName, tableName}
+	return "SELECT DISTINCT table_name FROM information_schema.key_column_usage " +
+		"WHERE table_schema = DATABASE() AND referenced_table_name = ? AND table_name <> ? ORDER BY table_name", args
+}
+
+func (m *mysql) ForeignKeyChecks(enable bool) string {
+	if enable {
+		return "SET FOREIGN_KEY_CHECKS = 1"
+	}
+	return "SET FOREIGN_KEY_CHECKS = 0"
+}
+
+func (m *mysql) ConnectionSQL() []string {
+	return nil
+}
+
+func (m *mysql) BindVar(n int) string {
+	return "?"
+}
+
+func (m *mysql) AutoIncrement(typ string) (string, string) {
+	return typ, "AUTO_INCREMENT"
+}
+
+func (m *mysql) Quote(identifier string) string {
+	return "`" + strings.ReplaceAll(identifier, "`", "``") + "`"
+}
+
+func (m *mysql) ResetAutoIncrementSQL(tableName, column string) string {
+	return ""
+}
+
+func (m *mysql) Returning(column string) string {
+	return ""
+}
+
+// Retryable matches deadlocks (1213) and lock wait timeouts (1205) by the
+// message of the driver, "Error 1213 (40001): Deadlock found ...".
+func (m *mysql) Retryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	msg := err.Error()
+	return strings.HasPrefix(msg, "Error 1213") || strings.HasPrefix(msg, "Error 1205")
+}
@@ -0,0 +1,50 @@
+package dialect_test
+
+import (
+	"database/sql"
+	"reflect"
+	"testing"
+	"time"
+
+	"orm/dialect"
+)
+
+func TestMySQLDataTypeOf(t *testing.T) {
+	dial, ok := dialect.GetDialect("mysql")
+	if !ok {
+		t.Fatal("mysql dialect is not registered")
+	}
+
+	tests := []struct {
+		value interface{}
+		size  int
+		want  string
+	}{
+		{true, 0, "boolean"},
+		{int8(0), 0, "tinyint"},
+		{0, 0, "int"},
+		{uint(0), 0, "int unsigned"},
+		{int64(0), 0, "bigint"},
+		{float64(0), 0, "double"},
+		{"", 0, "varchar(255)"},
+		{"", 32, "varchar(32)"},
+		{[]byte{}, 0, "longblob"},
+		{[]byte{}, 16, "varbinary(16)"},
+		{time.Time{}, 0, "datetime"},
+		{sql.NullTime{}, 0, "datetime"},
+		{(*time.Time)(nil), 0, "datetime"},
+		{sql.NullString{}, 0, "varchar(255)"},
+		{sql.NullInt32{}, 0, "int"},
+		{sql.NullFloat64{}, 0, "double"},
+		{struct{}{}, 0, ""},
+	}
+	for _, tt := range tests {
+		if got := dial.DataTypeOf(reflect.ValueOf(tt.value), tt.size); got != tt.want {
+			t.Fatalf("DataTypeOf(%T, %d) = %q, want %q", tt.value, tt.size, got, tt.want)
+		}
+	}
+
+	if typ, keyword := dial.AutoIncrement("bigint"); typ != "bigint" || keyword != "AUTO_INCREMENT" {
+		t.Fatal("failed to declare auto increment, got", typ, keyword)
+	}
+}
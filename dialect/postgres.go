@@ -0,0 +1,174 @@
+package dialect
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type postgres struct{}
+
+func init() {
+	RegisterDialect("postgres", &postgres{})
+	RegisterDialect("pgx", &postgres{})
+}
+
+func (p *postgres) DataTypeOf(typ reflect.Value, size int) string {
+	switch typ.Kind() {
+	case reflect.Ptr:
+		// a nil pointer is NULL
+		return p.DataTypeOf(reflect.Zero(typ.Type().Elem()), size)
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int8, reflect.Int16, reflect.Uint8:
+		return "smallint"
+	case reflect.Int, reflect.Int32, reflect.Uint16:
+		return "integer"
+	case reflect.Int64, reflect.Uint, reflect.Uint32, reflect.Uint64:
+		return "bigint"
+	case reflect.Float32:
+		return "real"
+	case reflect.Float64:
+		return "double precision"
+	case reflect.String:
+		if size > 0 {
+			return fmt.Sprintf("varchar(%d)", size)
+		}
+		return "text"
+	case reflect.Array, reflect.Slice:
+		return "bytea"
+	case reflect.Struct:
+		if _, ok := typ.Interface().(time.Time); ok {
+			return "timestamp"
+		}
+		if v, ok := nullValue(typ); ok {
+			return p.DataTypeOf(v, size)
+		}
+	}
+	return ""
+}
+
+func (p *postgres) TableExistSQL(tableName string) (string, []interface{}) {
+	args := []interface{}{tableName}
+	return "SELECT table_name FROM information_schema.tables WHERE table_schema = current_schema() AND table_name = $1", args
+}
+
+// ColumnsSQL reads pg_attribute, serial columns are told apart by their
+// nextval default and casts are stripped from the defaults.
+func (p *postgres) ColumnsSQL(tableName string) (string, []interface{}) {
+	args := []interface{}{tableName}
+	return `SELECT a.attname,
+	CASE WHEN pg_get_expr(d.adbin, d.adrelid) LIKE 'nextval(%' THEN
+		CASE a.atttypid WHEN 'int8'::regtype THEN 'bigserial' WHEN 'int2'::regtype THEN 'smallserial' ELSE 'serial' END
+	ELSE replace(replace(format_type(a.atttypid, a.atttypmod),
+		'character varying', 'varchar'), 'timestamp without time zone', 'timestamp') END,
+	a.attnotnull,
+	CASE WHEN pg_get_expr(d.adbin, d.adrelid) LIKE 'nextval(%' THEN NULL
+	ELSE regexp_replace(pg_get_expr(d.adbin, d.adrelid), '::[a-z ]+$', '') END,
+	COALESCE(a.attnum = ANY(i.indkey), false),
+	EXISTS (SELECT 1 FROM pg_constraint c WHERE c.conrelid = a.attrelid AND c.contype = 'u' AND c.conkey = ARRAY[a.attnum]),
+	COALESCE(pg_get_expr(d.adbin, d.adrelid) LIKE 'nextval(%', false)
+FROM pg_attribute a
+LEFT JOIN pg_attrdef d ON d.adrelid = a.attrelid AND d.adnum = a.attnum
+LEFT JOIN pg_index i ON i.indrelid = a.attrelid AND i.indisprimary
+WHERE a.attrelid = to_regclass(quote_ident($1)) AND a.attnum > 0 AND NOT a.attisdropped
+ORDER BY a.attnum`, args
+}
+
+// IndexesSQL rebuilds the definitions from pg_index, pg_indexes.indexdef
+// spells them with the access method and the schema of the table. The
+// predicate of a partial index is printed by the database, without its outer
+// parentheses.
+func (p *postgres) IndexesSQL(tableName string) (string, []interface{}) {
+	args := []interface{}{tableName}
+	return `SELECT c.relname,
+	'CREATE ' || CASE WHEN ix.indisunique THEN 'UNIQUE ' ELSE '' END ||
+	'INDEX "' || replace(c.relname, '"', '""') || '" ON "' || replace($1, '"', '""') || '" (' ||
+	(SELECT string_agg('"' || replace(a.attname, '"', '""') || '"', ', ' ORDER BY k.n)
+		FROM unnest(ix.indkey::int2[]) WITH ORDINALITY k(attnum, n)
+		JOIN pg_attribute a ON a.attrelid = ix.indrelid AND a.attnum = k.attnum) || ')' ||
+	COALESCE(' WHERE ' || regexp_replace(pg_get_expr(ix.indpred, ix.indrelid), '^\((.*)\)$', '\1'), '')
+FROM pg_index ix
+JOIN pg_class c ON c.oid = ix.indexrelid
+WHERE ix.indrelid = to_regclass(quote_ident($1)) AND NOT ix.indisprimary
+	AND c.relname NOT IN (SELECT conname FROM pg_constraint WHERE conrelid = ix.indrelid)
+ORDER BY c.relname`, args
+}
+
+func (p *postgres) DropIndexSQL(tableName, indexName string) string {
+	return "DROP INDEX " + p.Quote(indexName)
+}
+
+func (p *postgres) ForeignKeysSQL(tableName string) (string, []interface{}) {
+	args := []interface{}{tableName}
+	return `SELECT a.attname, r.relname, ra.attname,
+	CASE c.confdeltype WHEN 'c' THEN 'CASCADE' WHEN 'n' THEN 'SET NULL' WHEN 'd' THEN 'SET DEFAULT'
+		WHEN 'r' THEN 'RESTRICT' ELSE 'NO ACTION' END,
+	CASE c.confupdtype WHEN 'c' THEN 'CASCADE' WHEN 'n' THEN 'SET NULL' WHEN 'd' THEN 'SET DEFAULT'
+		WHEN 'r' THEN 'RESTRICT' ELSE 'NO ACTION' END
+FROM pg_constraint c
+JOIN pg_attribute a ON a.attrelid = c.conrelid AND a.attnum = c.conkey[1]
+JOIN pg_class r ON r.oid = c.confrelid
+JOIN pg_attribute ra ON ra.attrelid = c.confrelid AND ra.attnum = c.confkey[1]
+WHERE c.contype = 'f' AND c.conrelid = to_regclass(quote_ident($1))
+ORDER BY a.attnum`, args
+}
+
+func (p *postgres) ReferencingTablesSQL(tableName string) (string, []interface{}) {
+	args := []interface{}{tableName}
+	return `SELECT DISTINCT c.conrelid::regclass::text FROM pg_constraint c
+WHERE c.contype = 'f' AND c.confrelid = to_regclass(quote_ident($1)) AND c.conrelid <> c.confrelid
+ORDER BY 1`, args
+}
+
+// ForeignKeyChecks returns "", PostgreSQL always enforces foreign keys.
+func (p *postgres) ForeignKeyChecks(enable bool) string {
+	return ""
+}
+
+func (p *postgres) ConnectionSQL() []string {
+	return nil
+}
+
+func (p *postgres) BindVar(n int) string {
+	return "$" + strconv.Itoa(n)
+}
+
+func (p *postgres) Quote(identifier string) string {
+	return quoteIdent(identifier)
+}
+
+func (p *postgres) AutoIncrement(typ string) (string, string) {
+	switch typ {
+	case "bigint":
+		return "bigserial", ""
+	case "smallint":
+		return "smallserial", ""
+	}
+	return "serial", ""
+}
+
+// ResetAutoIncrementSQL sets the sequence of a serial column, which rows
+// inserted with their keys leave behind.
+func (p *postgres) ResetAutoIncrementSQL(tableName, column string) string {
+	literal := func(s string) string { return "'" + strings.ReplaceAll(s, "'", "''") + "'" }
+	return fmt.Sprintf("SELECT setval(pg_get_serial_sequence(%s, %s), COALESCE(MAX(%s), 0) + 1, false) FROM %s",
+		literal(p.Quote(tableName)), literal(column), p.Quote(column), p.Quote(tableName))
+}
+
+// Returning reads the key back with RETURNING, lib/pq and pgx do not
+// implement LastInsertId.
+func (p *postgres) Returning(column string) string {
+	return "RETURNING " + p.Quote(column)
+}
+
+// Retryable matches serialization_failure and deadlock_detected.
+func (p *postgres) Retryable(err error) bool {
+	switch sqlState(err) {
+	case "40001", "40P01":
+		return true
+	}
+	return false
+}
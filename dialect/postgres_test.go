@@ -0,0 +1,122 @@
+package dialect_test
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"orm/clause"
+	"orm/dialect"
+	"orm/schema"
+)
+
+type Order struct {
+	ID        int64 `orm:"primary key;auto increment"`
+	Customer  string
+	Paid      bool
+	Total     float64
+	CreatedAt time.Time
+}
+
+func TestPostgresDataTypeOf(t *testing.T) {
+	dial, ok := dialect.GetDialect("postgres")
+	if !ok {
+		t.Fatal("postgres dialect is not registered")
+	}
+
+	tests := []struct {
+		value interface{}
+		size  int
+		want  string
+	}{
+		{true, 0, "boolean"},
+		{int16(0), 0, "smallint"},
+		{0, 0, "integer"},
+		{int64(0), 0, "bigint"},
+		{float32(0), 0, "real"},
+		{float64(0), 0, "double precision"},
+		{"", 0, "text"},
+		{"", 64, "varchar(64)"},
+		{[]byte{}, 0, "bytea"},
+		{time.Time{}, 0, "timestamp"},
+		{sql.NullTime{}, 0, "timestamp"},
+		{(*time.Time)(nil), 0, "timestamp"},
+		{sql.NullString{}, 32, "varchar(32)"},
+		{sql.NullInt64{}, 0, "bigint"},
+		{sql.NullBool{}, 0, "boolean"},
+		{sql.Null[float64]{}, 0, "double precision"},
+		{map[string]int{}, 0, ""},
+	}
+	for _, tt := range tests {
+		if got := dial.DataTypeOf(reflect.ValueOf(tt.value), tt.size); got != tt.want {
+			t.Fatalf("DataTypeOf(%T) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestPostgresSQL(t *testing.T) {
+	dial, _ := dialect.GetDialect("postgres")
+
+	sql, vars := dial.TableExistSQL("orders")
+	if !strings.HasSuffix(sql, "table_name = $1") || !reflect.DeepEqual(vars, []interface{}{"orders"}) {
+		t.Fatal("failed to build table exist SQL, got", sql, vars)
+	}
+
+	table, err := schema.Parse(&Order{}, dial)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `"ID" bigserial PRIMARY KEY,"Customer" text,"Paid" boolean,"Total" double precision,"CreatedAt" timestamp`
+	if got := strings.Join(table.ColumnDefinitions(), ","); got != want {
+		t.Fatalf("expect columns %q, got %q", want, got)
+	}
+
+	c := clause.New(dial)
+	c.Set(clause.INSERT, "orders", []string{"Customer", "Paid"})
+	c.Set(clause.VALUES, []interface{}{"Tom", true}, []interface{}{"Sam", false})
+	sql, vars = c.Build(clause.INSERT, clause.VALUES)
+	if sql != `INSERT INTO "orders" ("Customer","Paid") VALUES ($1, $2), ($3, $4)` || len(vars) != 4 {
+		t.Fatal("failed to build insert, got", sql)
+	}
+
+	c = clause.New(dial)
+	c.Set(clause.SELECT, "orders", []string{"*"})
+	c.AndWhere(clause.Expr("Customer = ? AND Note <> '?'", "Tom"))
+	c.OrWhere(clause.Expr("Total > ?", 100))
+	c.Set(clause.LIMIT, 10)
+	sql, vars = c.Build(clause.SELECT, clause.WHERE, clause.LIMIT)
+	want = `SELECT * FROM "orders" WHERE (Customer = $1 AND Note <> '?') OR (Total > $2) LIMIT $3`
+	if sql != want || !reflect.DeepEqual(vars, []interface{}{"Tom", 100, 10}) {
+		t.Fatal("failed to build select, got", sql, vars)
+	}
+}
+
+type pgError struct{ code string }
+
+func (e *pgError) Error() string    { return "pq: error " + e.code }
+func (e *pgError) SQLState() string { return e.code }
+
+func TestRetryable(t *testing.T) {
+	tests := []struct {
+		dialect string
+		err     error
+		want    bool
+	}{
+		{"sqlite3", errors.New("database is locked"), true},
+		{"sqlite3", errors.New("UNIQUE constraint failed: users.Name"), false},
+		{"postgres", fmt.Errorf("commit: %w", &pgError{"40001"}), true},
+		{"postgres", &pgError{"23505"}, false},
+		{"mysql", errors.New("Error 1213 (40001): Deadlock found when trying to get lock"), true},
+		{"mysql", errors.New("Error 1062 (23000): Duplicate entry"), false},
+	}
+	for _, tt := range tests {
+		dial, _ := dialect.GetDialect(tt.dialect)
+		if got := dial.Retryable(tt.err); got != tt.want {
+			t.Errorf("%s: Retryable(%v) = %v, want %v", tt.dialect, tt.err, got, tt.want)
+		}
+	}
+}
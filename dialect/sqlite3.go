@@ -1,8 +1,8 @@
 package dialect
 
 import (
-	"fmt"
 	"reflect"
+	"strings"
 	"time"
 )
 
@@ -12,8 +12,11 @@ func init() {
 	RegisterDialect("sqlite3", &sqlite3{})
 }
 
-func (s *sqlite3) DataTypeOf(typ reflect.Value) string {
+func (s *sqlite3) DataTypeOf(typ reflect.Value, size int) string {
 	switch typ.Kind() {
+	case reflect.Ptr:
+		// a nil pointer is NULL
+		return s.DataTypeOf(reflect.Zero(typ.Type().Elem()), size)
 	case reflect.Bool:
 		return "bool"
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32,
@@ -31,12 +34,92 @@ func (s *sqlite3) DataTypeOf(typ reflect.Value) string {
 		if _, ok := typ.Interface().(time.Time); ok {
 			return "datetime"
 		}
-
+		if v, ok := nullValue(typ); ok {
+			return s.DataTypeOf(v, size)
+		}
 	}
-	panic(fmt.Sprintf("invalid sql type %s (%s)", typ.Type().Name(), typ.Kind()))
+	return ""
 }
 
 func (s *sqlite3) TableExistSQL(tableName string) (string, []interface{}) {
 	args := []interface{}{"table", tableName}
 	return "SELECT name from sqlite_master where type=? and name = ?", args
 }
+
+// ColumnsSQL finds UNIQUE constraints by their index origin and AUTOINCREMENT
+// in the CREATE TABLE statement, pragma_table_info reports neither.
+func (s *sqlite3) ColumnsSQL(tableName string) (string, []interface{}) {
+	args := []interface{}{tableName, tableName, tableName}
+	return `SELECT t.name, t.type, t."notnull", t.dflt_value, t.pk > 0,
+	EXISTS (SELECT 1 FROM pragma_index_list(?) l
+		WHERE l.origin = 'u' AND (SELECT group_concat(name) FROM pragma_index_info(l.name)) = t.name),
+	t.pk > 0 AND (SELECT sql FROM sqlite_master WHERE type = 'table' AND name = ?) LIKE '%AUTOINCREMENT%'
+FROM pragma_table_info(?) t ORDER BY t.cid`, args
+}
+
+// IndexesSQL reads the CREATE INDEX statements SQLite keeps as written, the
+// automatic indexes have none.
+func (s *sqlite3) IndexesSQL(tableName string) (string, []interface{}) {
+	args := []interface{}{tableName}
+	return "SELECT name, trim(sql) FROM sqlite_master WHERE type = 'index' AND tbl_name = ? AND sql IS NOT NULL ORDER BY name", args
+}
+
+func (s *sqlite3) DropIndexSQL(tableName, indexName string) string {
+	return "DROP INDEX " + s.Quote(indexName)
+}
+
+func (s *sqlite3) ForeignKeysSQL(tableName string) (string, []interface{}) {
+	args := []interface{}{tableName}
+	return `SELECT "from", "table", "to", on_delete, on_update FROM pragma_foreign_key_list(?) ORDER BY id, seq`, args
+}
+
+func (s *sqlite3) ReferencingTablesSQL(tableName string) (string, []interface{}) {
+	args := []interface{}{tableName, tableName}
+	return `SELECT DISTINCT m.name FROM sqlite_master m, pragma_foreign_key_list(m.name) f
+WHERE m.type = 'table' AND f."table" = ? AND m.name <> ? ORDER BY m.name`, args
+}
+
+func (s *sqlite3) ForeignKeyChecks(enable bool) string {
+	if enable {
+		return "PRAGMA foreign_keys = ON"
+	}
+	return "PRAGMA foreign_keys = OFF"
+}
+
+// ConnectionSQL enables foreign keys, SQLite leaves them off by default.
+func (s *sqlite3) ConnectionSQL() []string {
+	return []string{s.ForeignKeyChecks(true)}
+}
+
+func (s *sqlite3) BindVar(n int) string {
+	return "?"
+}
+
+func (s *sqlite3) Quote(identifier string) string {
+	return quoteIdent(identifier)
+}
+
+// AUTOINCREMENT is only allowed on an INTEGER PRIMARY KEY.
+func (s *sqlite3) AutoIncrement(typ string) (string, string) {
+	return "integer", "AUTOINCREMENT"
+}
+
+func (s *sqlite3) ResetAutoIncrementSQL(tableName, column string) string {
+	return ""
+}
+
+func (s *sqlite3) Returning(column string) string {
+	return ""
+}
+
+// Retryable matches SQLITE_BUSY and SQLITE_LOCKED by their message, so the
+// dialect does not depend on the cgo driver.
+func (s *sqlite3) Retryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	msg := err.Error()
+	return strings.Contains(msg, "database is locked") ||
+		strings.Contains(msg, "database table is locked") ||
+		strings.Contains(msg, "SQLITE_BUSY")
+}
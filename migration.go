@@ -0,0 +1,221 @@
+package orm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"orm/log"
+	"orm/session"
+)
+
+// Migration is a versioned change of the schema. Up applies it and Down
+// reverts it, each runs in the transaction recording the change in the
+// schema_migrations table.
+type Migration struct {
+	Version int64
+	Name    string
+	Up      func(*session.Session) error
+	// Down may be nil for a migration which cannot be reverted
+	Down func(*session.Session) error
+}
+
+// MigrationState is the state of a migration reported by MigrationStatus.
+type MigrationState struct {
+	Version   int64
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// schemaMigration is a row of the migration history.
+type schemaMigration struct {
+	Version   int64     `orm:"column:version;primary key"`
+	Name      string    `orm:"column:name"`
+	AppliedAt time.Time `orm:"column:applied_at"`
+}
+
+func (m *schemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// AddMigrations registers migrations, they are applied in increasing version.
+// The migrations are registered all or none: when one is invalid, the error
+// is returned and none of them is.
+func (engine *Engine) AddMigrations(migrations ...Migration) error {
+	seen := make(map[int64]bool)
+	for _, m := range migrations {
+		if m.Version <= 0 {
+			return fmt.Errorf("migration %q: version must be positive", m.Name)
+		}
+		if m.Up == nil {
+			return fmt.Errorf("migration %d: Up is required", m.Version)
+		}
+		if seen[m.Version] || engine.migration(m.Version) != nil {
+			return fmt.Errorf("migration %d is already registered", m.Version)
+		}
+		seen[m.Version] = true
+	}
+	engine.migrations = append(engine.migrations, migrations...)
+	sort.Slice(engine.migrations, func(i, j int) bool {
+		return engine.migrations[i].Version < engine.migrations[j].Version
+	})
+	return nil
+}
+
+func (engine *Engine) migration(version int64) *Migration {
+	for i := range engine.migrations {
+		if engine.migrations[i].Version == version {
+			return &engine.migrations[i]
+		}
+	}
+	return nil
+}
+
+// history returns the applied migrations in increasing version, it creates
+// the schema_migrations table on first use.
+func (engine *Engine) history(ctx context.Context) ([]schemaMigration, error) {
+	s := engine.NewSessionContext(ctx).Model(&schemaMigration{})
+	if !s.HasTable() {
+		if err := s.CreateTable(); err != nil {
+			return nil, err
+		}
+	}
+	var applied []schemaMigration
+	if err := s.OrderBy("version").Find(&applied); err != nil {
+		return nil, err
+	}
+	for _, h := range applied {
+		if engine.migration(h.Version) == nil {
+			return nil, fmt.Errorf("applied migration %d is not registered", h.Version)
+		}
+	}
+	return applied, nil
+}
+
+func (engine *Engine) MigrateUp() error {
+	return engine.MigrateUpContext(context.Background())
+}
+
+// MigrateUpContext applies every pending migration.
+func (engine *Engine) MigrateUpContext(ctx context.Context) error {
+	if len(engine.migrations) == 0 {
+		return nil
+	}
+	return engine.MigrateToContext(ctx, engine.migrations[len(engine.migrations)-1].Version)
+}
+
+func (engine *Engine) MigrateDown(n int) error {
+	return engine.MigrateDownContext(context.Background(), n)
+}
+
+// MigrateDownContext reverts the n latest applied migrations.
+func (engine *Engine) MigrateDownContext(ctx context.Context, n int) error {
+	applied, err := engine.history(ctx)
+	if err != nil {
+		return err
+	}
+	if n > len(applied) {
+		n = len(applied)
+	}
+	for i := len(applied) - 1; i >= len(applied)-n; i-- {
+		if err := engine.revert(ctx, engine.migration(applied[i].Version)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (engine *Engine) MigrateTo(version int64) error {
+	return engine.MigrateToContext(context.Background(), version)
+}
+
+// MigrateToContext applies the pending migrations up to version and reverts
+// the applied ones after it, version 0 reverts every migration.
+func (engine *Engine) MigrateToContext(ctx context.Context, version int64) error {
+	if version != 0 && engine.migration(version) == nil {
+		return fmt.Errorf("migration %d is not registered", version)
+	}
+	applied, err := engine.history(ctx)
+	if err != nil {
+		return err
+	}
+
+	for i := len(applied) - 1; i >= 0 && applied[i].Version > version; i-- {
+		if err := engine.revert(ctx, engine.migration(applied[i].Version)); err != nil {
+			return err
+		}
+	}
+
+	done := make(map[int64]bool)
+	for _, h := range applied {
+		done[h.Version] = true
+	}
+	for i := range engine.migrations {
+		m := &engine.migrations[i]
+		if m.Version > version {
+			break
+		}
+		if !done[m.Version] {
+			if err := engine.apply(ctx, m); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (engine *Engine) apply(ctx context.Context, m *Migration) error {
+	log.Infof("apply migration %d %s", m.Version, m.Name)
+	_, err := engine.TransactionContext(ctx, func(s *session.Session) (interface{}, error) {
+		if err := m.Up(s); err != nil {
+			return nil, fmt.Errorf("migration %d: %w", m.Version, err)
+		}
+		return s.Insert(&schemaMigration{Version: m.Version, Name: m.Name, AppliedAt: s.Now()})
+	})
+	return err
+}
+
+func (engine *Engine) revert(ctx context.Context, m *Migration) error {
+	if m.Down == nil {
+		return fmt.Errorf("migration %d cannot be reverted", m.Version)
+	}
+	log.Infof("revert migration %d %s", m.Version, m.Name)
+	_, err := engine.TransactionContext(ctx, func(s *session.Session) (interface{}, error) {
+		if err := m.Down(s); err != nil {
+			return nil, fmt.Errorf("migration %d: %w", m.Version, err)
+		}
+		n, err := s.DeleteModel(&schemaMigration{Version: m.Version})
+		if err == nil && n != 1 {
+			err = errors.New("migration history changed concurrently")
+		}
+		return n, err
+	})
+	return err
+}
+
+func (engine *Engine) MigrationStatus() ([]MigrationState, error) {
+	return engine.MigrationStatusContext(context.Background())
+}
+
+// MigrationStatusContext returns the state of every registered migration in
+// increasing version.
+func (engine *Engine) MigrationStatusContext(ctx context.Context) ([]MigrationState, error) {
+	applied, err := engine.history(ctx)
+	if err != nil {
+		return nil, err
+	}
+	appliedAt := make(map[int64]time.Time)
+	for _, h := range applied {
+		appliedAt[h.Version] = h.AppliedAt
+	}
+
+	var states []MigrationState
+	for _, m := range engine.migrations {
+		at, ok := appliedAt[m.Version]
+		states = append(states, MigrationState{Version: m.Version, Name: m.Name, Applied: ok, AppliedAt: at})
+	}
+	return states, nil
+}
@@ -0,0 +1,206 @@
+package orm
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"orm/session"
+)
+
+type Product struct {
+	ID   int64 `orm:"primary key"`
+	Name string
+}
+
+func productMigrations() []Migration {
+	return []Migration{
+		{
+			Version: 1,
+			Name:    "create products",
+			Up: func(s *session.Session) error {
+				return s.Model(&Product{}).CreateTable()
+			},
+			Down: func(s *session.Session) error {
+				return s.Model(&Product{}).DropTable()
+			},
+		},
+		{
+			Version: 2,
+			Name:    "seed products",
+			Up: func(s *session.Session) error {
+				_, err := s.Insert([]*Product{{ID: 1, Name: "Book"}, {ID: 2, Name: "Pen"}})
+				return err
+			},
+			Down: func(s *session.Session) error {
+				_, err := s.Model(&Product{}).Delete()
+				return err
+			},
+		},
+		{
+			Version: 3,
+			Name:    "drop pens",
+			Up: func(s *session.Session) error {
+				_, err := s.Model(&Product{}).Where("Name = ?", "Pen").Delete()
+				return err
+			},
+		},
+	}
+}
+
+func openMigrationDB(t *testing.T) *Engine {
+	t.Helper()
+	engine := OpenDB(t)
+	s := engine.NewSession()
+	_ = s.Model(&Product{}).DropTable()
+	_ = s.Model(&schemaMigration{}).DropTable()
+	if err := engine.AddMigrations(productMigrations()...); err != nil {
+		t.Fatal(err)
+	}
+	return engine
+}
+
+func expectApplied(t *testing.T, engine *Engine, want ...bool) {
+	t.Helper()
+	states, err := engine.MigrationStatus()
+	if err != nil || len(states) != len(want) {
+		t.Fatal("failed to get migration status", err, states)
+	}
+	for i, state := range states {
+		if state.Applied != want[i] || state.Applied == state.AppliedAt.IsZero() {
+			t.Fatalf("migration %d: expect applied %v, got %+v", state.Version, want[i], state)
+		}
+	}
+}
+
+func TestMigrateUpDown(t *testing.T) {
+	engine := openMigrationDB(t)
+	defer engine.Close()
+	s := engine.NewSession().Model(&Product{})
+
+	if err := engine.MigrateTo(2); err != nil {
+		t.Fatal(err)
+	}
+	expectApplied(t, engine, true, true, false)
+	if count, _ := s.Count(); count != 2 {
+		t.Fatal("expect 2 products, got", count)
+	}
+
+	if err := engine.MigrateUp(); err != nil {
+		t.Fatal(err)
+	}
+	expectApplied(t, engine, true, true, true)
+	if count, _ := s.Count(); count != 1 {
+		t.Fatal("expect 1 product, got", count)
+	}
+
+	if err := engine.MigrateDown(1); err == nil {
+		t.Fatal("expect error reverting a migration without Down")
+	}
+
+	if err := engine.MigrateTo(1); err == nil {
+		t.Fatal("expect error migrating down past a migration without Down")
+	}
+	expectApplied(t, engine, true, true, true)
+}
+
+func TestMigrateClock(t *testing.T) {
+	engine := openMigrationDB(t)
+	defer engine.Close()
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	engine.SetClock(func() time.Time { return now })
+
+	if err := engine.MigrateTo(1); err != nil {
+		t.Fatal(err)
+	}
+	states, err := engine.MigrationStatus()
+	if err != nil || !states[0].AppliedAt.Equal(now) {
+		t.Fatal("expect the migration to be applied at the engine time, got", states, err)
+	}
+}
+
+func TestMigrateTo(t *testing.T) {
+	engine := openMigrationDB(t)
+	defer engine.Close()
+	s := engine.NewSession().Model(&Product{})
+
+	if err := engine.MigrateTo(2); err != nil {
+		t.Fatal(err)
+	}
+	if err := engine.MigrateDown(1); err != nil {
+		t.Fatal(err)
+	}
+	expectApplied(t, engine, true, false, false)
+	if count, _ := s.Count(); count != 0 {
+		t.Fatal("expect no product, got", count)
+	}
+
+	if err := engine.MigrateTo(0); err != nil {
+		t.Fatal(err)
+	}
+	expectApplied(t, engine, false, false, false)
+	if s.HasTable() {
+		t.Fatal("failed to revert the creation of products")
+	}
+
+	if err := engine.MigrateTo(4); err == nil {
+		t.Fatal("expect error migrating to an unknown version")
+	}
+}
+
+func TestMigrateFailureRollsBack(t *testing.T) {
+	engine := openMigrationDB(t)
+	defer engine.Close()
+
+	err := engine.AddMigrations(Migration{
+		Version: 4,
+		Name:    "broken",
+		Up: func(s *session.Session) error {
+			if _, err := s.Insert(&Product{ID: 3, Name: "Ink"}); err != nil {
+				return err
+			}
+			return errors.New("Error")
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := engine.AddMigrations(Migration{Version: 4, Up: func(*session.Session) error { return nil }}); err == nil {
+		t.Fatal("expect error registering a version twice")
+	}
+
+	if err := engine.MigrateUp(); err == nil {
+		t.Fatal("expect the broken migration to fail")
+	}
+	expectApplied(t, engine, true, true, true, false)
+	if err := engine.NewSession().Get(&Product{}, 3); err == nil {
+		t.Fatal("failed to roll back the broken migration")
+	}
+}
+
+func TestAddMigrationsAllOrNone(t *testing.T) {
+	engine := openMigrationDB(t)
+	defer engine.Close()
+	up := func(*session.Session) error { return nil }
+
+	invalid := [][]Migration{
+		{{Version: 5, Up: up}, {Version: 0, Up: up}},
+		{{Version: 5, Up: up}, {Version: 6}},
+		{{Version: 5, Up: up}, {Version: 2, Up: up}},
+		{{Version: 5, Up: up}, {Version: 5, Up: up}},
+	}
+	for _, migrations := range invalid {
+		if err := engine.AddMigrations(migrations...); err == nil {
+			t.Fatal("expect error registering", migrations)
+		}
+		expectApplied(t, engine, false, false, false)
+	}
+
+	if err := engine.AddMigrations(Migration{Version: 6, Up: up}, Migration{Version: 5, Up: up}); err != nil {
+		t.Fatal(err)
+	}
+	states, _ := engine.MigrationStatus()
+	if len(states) != 5 || states[3].Version != 5 || states[4].Version != 6 {
+		t.Fatal("failed to register migrations in version order, got", states)
+	}
+}
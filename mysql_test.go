@@ -0,0 +1,270 @@
+package orm
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"orm/dialect"
+)
+
+// recorder is a database/sql driver which records every statement instead of
+// talking to a server, so SQL generation can be checked for any dialect.
+type recorder struct {
+	mu    sync.Mutex
+	stmts []string
+	// rows answers queries, nil columns means an empty result
+	rows func(query string) ([]string, [][]driver.Value)
+}
+
+var mysqlRecorder = &recorder{}
+
+func init() {
+	sql.Register("mysql", mysqlRecorder)
+}
+
+func (r *recorder) reset(rows func(query string) ([]string, [][]driver.Value)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.stmts = nil
+	r.rows = rows
+}
+
+func (r *recorder) statements() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.stmts...)
+}
+
+func (r *recorder) Open(name string) (driver.Conn, error) { return &recorderConn{r}, nil }
+
+type recorderConn struct{ r *recorder }
+
+func (c *recorderConn) Prepare(query string) (driver.Stmt, error) {
+	return &recorderStmt{r: c.r, query: query}, nil
+}
+func (c *recorderConn) Close() error              { return nil }
+func (c *recorderConn) Begin() (driver.Tx, error) { return c, nil }
+func (c *recorderConn) Commit() error             { return nil }
+func (c *recorderConn) Rollback() error           { return nil }
+
+type recorderStmt struct {
+	r     *recorder
+	query string
+}
+
+func (s *recorderStmt) Close() error  { return nil }
+func (s *recorderStmt) NumInput() int { return -1 }
+
+func (s *recorderStmt) record() {
+	s.r.mu.Lock()
+	defer s.r.mu.Unlock()
+	s.r.stmts = append(s.r.stmts, strings.TrimSpace(s.query))
+}
+
+func (s *recorderStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.record()
+	return recorderResult{}, nil
+}
+
+type recorderResult struct{}
+
+func (recorderResult) LastInsertId() (int64, error) { return 1, nil }
+func (recorderResult) RowsAffected() (int64, error) { return 1, nil }
+
+func (s *recorderStmt) Query(args []driver.Value) (driver.Rows, error) {
+	s.record()
+	rows := &recorderRows{}
+	if s.r.rows != nil {
+		rows.columns, rows.values = s.r.rows(s.query)
+	}
+	return rows, nil
+}
+
+type recorderRows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+func (r *recorderRows) Columns() []string { return r.columns }
+func (r *recorderRows) Close() error      { return nil }
+
+func (r *recorderRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+type Order struct {
+	ID       int64  `orm:"primary key;auto increment"`
+	Customer string `orm:"size:64;not null"`
+	Total    float64
+	Note     string
+	Tags     []byte
+}
+
+func openMySQL(t *testing.T, rows func(query string) ([]string, [][]driver.Value)) *Engine {
+	t.Helper()
+	engine, err := NewEngine("mysql", "recorder")
+	if err != nil || engine == nil {
+		t.Fatal("failed to connect", err)
+	}
+	mysqlRecorder.reset(rows)
+	return engine
+}
+
+func expectStatements(t *testing.T, r *recorder, want ...string) {
+	t.Helper()
+	if got := r.statements(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("expect statements\n%s\ngot\n%s", strings.Join(want, "\n"), strings.Join(got, "\n"))
+	}
+}
+
+func TestMySQLCreateTable(t *testing.T) {
+	engine := openMySQL(t, nil)
+	defer engine.Close()
+
+	if err := engine.NewSession().Model(&Order{}).CreateTable(); err != nil {
+		t.Fatal(err)
+	}
+	expectStatements(t, mysqlRecorder,
+		"CREATE TABLE `Order` (`ID` bigint PRIMARY KEY AUTO_INCREMENT,`Customer` varchar(64) NOT NULL,"+
+			"`Total` double,`Note` varchar(255),`Tags` longblob);")
+}
+
+func TestMySQLCreateJoinTable(t *testing.T) {
+	bookExists := false
+	rows := func(query string) ([]string, [][]driver.Value) {
+		if bookExists {
+			return []string{"table_name"}, [][]driver.Value{{"Book"}}
+		}
+		return nil, nil
+	}
+	engine := openMySQL(t, rows)
+	defer engine.Close()
+	tableExistSQL, _ := mysqlDialect.TableExistSQL("Book")
+
+	// the join table references Book, which does not exist yet
+	if err := engine.NewSession().Model(&Reader{}).CreateTable(); err != nil {
+		t.Fatal(err)
+	}
+	createReader := "CREATE TABLE `Reader` (`ID` int PRIMARY KEY);"
+	expectStatements(t, mysqlRecorder, tableExistSQL, createReader)
+
+	bookExists = true
+	mysqlRecorder.reset(rows)
+	if err := engine.NewSession().Model(&Reader{}).CreateTable(); err != nil {
+		t.Fatal(err)
+	}
+	expectStatements(t, mysqlRecorder, tableExistSQL, createReader,
+		"CREATE TABLE IF NOT EXISTS `reader_books` (`ReaderID` int,`BookID` int,PRIMARY KEY (`ReaderID`, `BookID`),"+
+			"FOREIGN KEY (`ReaderID`) REFERENCES `Reader` (`ID`) ON DELETE CASCADE,"+
+			"FOREIGN KEY (`BookID`) REFERENCES `Book` (`ID`) ON DELETE CASCADE);")
+}
+
+func TestMySQLInsertAndFind(t *testing.T) {
+	engine := openMySQL(t, func(query string) ([]string, [][]driver.Value) {
+		return []string{"ID", "Customer", "Total", "Note", "Tags"},
+			[][]driver.Value{{int64(1), "Tom", 9.5, "", []byte{}}}
+	})
+	defer engine.Close()
+
+	s := engine.NewSession()
+	order := &Order{Customer: "Tom", Total: 9.5}
+	if _, err := s.Insert(order); err != nil || order.ID != 1 {
+		t.Fatal("failed to insert order", err)
+	}
+
+	var orders []Order
+	if err := s.Where("Customer = ?", "Tom").Limit(1).Find(&orders); err != nil || len(orders) != 1 {
+		t.Fatal("failed to find orders", err)
+	}
+	expectStatements(t, mysqlRecorder,
+		"INSERT INTO `Order` (`Customer`,`Total`,`Note`,`Tags`) VALUES (?, ?, ?, ?)",
+		"SELECT `ID`, `Customer`, `Total`, `Note`, `Tags` FROM `Order` WHERE Customer = ? LIMIT ?")
+}
+
+var (
+	mysqlDialect, _        = dialect.GetDialect("mysql")
+	mysqlColumnsSQL, _     = mysqlDialect.ColumnsSQL("Order")
+	mysqlForeignKeysSQL, _ = mysqlDialect.ForeignKeysSQL("Order")
+)
+
+// orderColumns answers the columns query with the columns of Order but Tags,
+// followed by the extra columns.
+func orderColumns(extra ...string) ([]string, [][]driver.Value) {
+	rows := [][]driver.Value{
+		{"ID", "bigint", true, nil, true, false, true},
+		{"Customer", "varchar(64)", true, nil, false, false, false},
+		{"Total", "double", false, nil, false, false, false},
+		{"Note", "varchar(255)", false, nil, false, false, false},
+	}
+	for _, name := range extra {
+		rows = append(rows, []driver.Value{name, "int", false, nil, false, false, false})
+	}
+	return []string{"name", "type", "not_null", "default", "primary_key", "unique", "auto_increment"}, rows
+}
+
+func TestMySQLMigrate(t *testing.T) {
+	engine := openMySQL(t, func(query string) ([]string, [][]driver.Value) {
+		if strings.Contains(query, "information_schema.tables") {
+			return []string{"table_name"}, [][]driver.Value{{"Order"}}
+		}
+		if strings.Contains(query, "key_column_usage") {
+			return nil, nil
+		}
+		return orderColumns("Legacy")
+	})
+	defer engine.Close()
+
+	if err := engine.Migrate(&Order{}); err != nil {
+		t.Fatal(err)
+	}
+	expectStatements(t, mysqlRecorder,
+		"SET FOREIGN_KEY_CHECKS = 0",
+		"SELECT table_name FROM information_schema.tables WHERE table_schema = DATABASE() AND table_name = ?",
+		mysqlColumnsSQL, mysqlForeignKeysSQL,
+		"CREATE TABLE `tmp_Order` (`ID` bigint PRIMARY KEY AUTO_INCREMENT,`Customer` varchar(64) NOT NULL,"+
+			"`Total` double,`Note` varchar(255),`Tags` longblob);",
+		"INSERT INTO `tmp_Order` (`ID`,`Customer`,`Total`,`Note`) SELECT `ID`,`Customer`,`Total`,`Note` FROM `Order`;",
+		"DROP TABLE `Order`;",
+		"ALTER TABLE `tmp_Order` RENAME TO `Order`;",
+		"SET FOREIGN_KEY_CHECKS = 1")
+}
+
+func TestMySQLPlanMigration(t *testing.T) {
+	engine := openMySQL(t, func(query string) ([]string, [][]driver.Value) {
+		if strings.Contains(query, "information_schema.tables") {
+			return []string{"table_name"}, [][]driver.Value{{"Order"}}
+		}
+		if strings.Contains(query, "GROUP_CONCAT") {
+			return []string{"index_name", "definition"},
+				[][]driver.Value{{"idx_legacy", "CREATE INDEX `idx_legacy` ON `Order` (`Note`)"}}
+		}
+		if strings.Contains(query, "key_column_usage") {
+			return nil, nil
+		}
+		return orderColumns()
+	})
+	defer engine.Close()
+
+	plan, err := engine.PlanMigration(&Order{})
+	want := []string{
+		"ALTER TABLE `Order` ADD COLUMN `Tags` longblob",
+		"DROP INDEX `idx_legacy` ON `Order`",
+	}
+	if err != nil || !reflect.DeepEqual(plan, want) {
+		t.Fatal("failed to plan migration, got", plan, err)
+	}
+	indexesSQL, _ := mysqlDialect.IndexesSQL("Order")
+	expectStatements(t, mysqlRecorder,
+		"SELECT table_name FROM information_schema.tables WHERE table_schema = DATABASE() AND table_name = ?",
+		mysqlColumnsSQL, mysqlForeignKeysSQL, indexesSQL)
+}
@@ -1,40 +1,64 @@
 package orm
 
 import (
+	"context"
 	"database/sql"
-	"errors"
+	"database/sql/driver"
 	"fmt"
+	"sort"
 	"strings"
+	"time"
 
 	"orm/dialect"
 	"orm/log"
+	"orm/schema"
 	"orm/session"
 )
 
 type Engine struct {
-	db      *sql.DB
-	dislect dialect.Dialect
+	db        *sql.DB
+	dislect   dialect.Dialect
+	callbacks *session.Callbacks
+	// clock of the sessions, time.Now when nil
+	clock func() time.Time
+	// migrations registered with AddMigrations, in increasing version
+	migrations []Migration
 }
 
 func NewEngine(driver, source string) (e *Engine, err error) {
+	return NewEngineContext(context.Background(), driver, source)
+}
+
+// NewEngineContext is like NewEngine, the connection check is bounded by ctx.
+func NewEngineContext(ctx context.Context, driver, source string) (e *Engine, err error) {
 	db, err := sql.Open(driver, source)
 	if err != nil {
 		log.Error(err)
 		return
 	}
 
-	if err = db.Ping(); err != nil {
+	dial, ok := dialect.GetDialect(driver)
+	if ok && len(dial.ConnectionSQL()) > 0 {
+		c, err := newConnector(db.Driver(), source, dial.ConnectionSQL())
+		if err != nil {
+			log.Error(err)
+			return nil, err
+		}
+		_ = db.Close()
+		db = sql.OpenDB(c)
+	}
+
+	if err = db.PingContext(ctx); err != nil {
 		log.Error(err)
 		return
 	}
 
-	dial, ok := dialect.GetDialect(driver)
 	if !ok {
 		log.Errorf("dialect %s Not Found", driver)
 		return
 	}
 
-	e = &Engine{db: db, dislect: dial}
+	e = &Engine{db: db, dislect: dial, callbacks: session.NewCallbacks()}
 	log.Info("Connect database success")
 	return
 }
@@ -47,29 +71,73 @@ func (e *Engine) Close() {
 }
 
 func (e *Engine) NewSession() *session.Session {
-	return session.New(e.db, e.dislect)
+	return session.New(e.db, e.dislect).WithCallbacks(e.callbacks).WithClock(e.clock)
+}
+
+// SetClock makes the sessions of the engine take the time of the timestamp
+// and soft delete fields from now, e.g. to freeze it in tests.
+func (e *Engine) SetClock(now func() time.Time) {
+	e.clock = now
+}
+
+// Callbacks returns the callbacks run by every session of the engine.
+func (e *Engine) Callbacks() *session.Callbacks {
+	return e.callbacks
+}
+
+// NewSessionContext returns a session whose statements run under ctx.
+func (e *Engine) NewSessionContext(ctx context.Context) *session.Session {
+	return e.NewSession().WithContext(ctx)
 }
 
 type TxFunc func(*session.Session) (interface{}, error)
 
 func (engine *Engine) Transaction(f TxFunc) (result interface{}, err error) {
-	s := engine.NewSession()
-	if err = s.Begin(); err != nil {
-		return nil, err
-	}
+	return engine.TransactionContext(context.Background(), f)
+}
 
-	defer func() {
-		if err != nil {
-			s.Rollback()
-		} else {
-			err = s.Commit()
-			if err != nil {
-				s.Rollback()
-			}
+// TransactionContext runs f in a transaction started with ctx, the session
+// passed to f carries ctx as well.
+func (engine *Engine) TransactionContext(ctx context.Context, f TxFunc) (result interface{}, err error) {
+	return engine.NewSessionContext(ctx).Transaction(f)
+}
+
+// TxOptions are the options of TransactionOptions.
+type TxOptions struct {
+	Isolation sql.IsolationLevel
+	ReadOnly  bool
+	// Retries is how many more times the transaction is run when it fails
+	// with an error the dialect reports as retryable, e.g. SQLITE_BUSY.
+	Retries int
+	// Backoff is the wait before the first retry, it doubles on each retry
+	// up to maxBackoff.
+	Backoff time.Duration
+}
+
+const maxBackoff = time.Second
+
+// TransactionOptions is like TransactionContext with the isolation level and
+// read-only mode of opts, and retries f on retryable errors. f must be safe
+// to run more than once.
+func (engine *Engine) TransactionOptions(ctx context.Context, opts TxOptions, f TxFunc) (result interface{}, err error) {
+	txOptions := &sql.TxOptions{Isolation: opts.Isolation, ReadOnly: opts.ReadOnly}
+	backoff := opts.Backoff
+	for retry := 0; ; retry++ {
+		result, err = engine.NewSessionContext(ctx).WithTxOptions(txOptions).Transaction(f)
+		if err == nil || retry >= opts.Retries || !engine.dislect.Retryable(err) {
+			return
 		}
-	}()
 
-	return f(s)
+		log.Infof("retry transaction in %v: %v", backoff, err)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
 }
 
 func difference(a, b []string) (diff []string) {
@@ -86,46 +154,290 @@ func difference(a, b []string) (diff []string) {
 	return
 }
 
-func (engine *Engine) Migrate(value interface{}) error {
-	_, err := engine.Transaction(func(s *session.Session) (result interface{}, err error) {
-		if !s.Model(value).HasTable() {
-			log.Info("Table %s doesn't exist", s.RefTable().Name)
-			return nil, s.CreateTable()
+// columnChanged reports whether the column c of the database no longer
+// matches the definition of f. NOT NULL is implied by PRIMARY KEY on some
+// databases, so it is only compared for the other columns.
+func columnChanged(f *schema.Field, c session.Column) bool {
+	if !strings.EqualFold(f.Type, c.Type) || f.PrimaryKey != c.PrimaryKey {
+		return true
+	}
+	if f.Unique != c.Unique || f.AutoIncrement != c.AutoIncrement {
+		return true
+	}
+	if !f.PrimaryKey && f.NotNull != c.NotNull {
+		return true
+	}
+	return f.HasDefault != c.Default.Valid || f.HasDefault && f.Default != c.Default.String
+}
+
+// sameForeignKeys reports whether a and b hold the same foreign keys, in any
+// order.
+func sameForeignKeys(a, b []*schema.ForeignKey) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for _, fk := range a {
+		found := false
+		for _, other := range b {
+			if fk.Equal(other) {
+				found = true
+				break
+			}
 		}
-		table := s.RefTable()
-		if table == nil {
-			return nil, errors.New("model is not a struct")
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// sortByDependency orders tables so each one comes after the tables its
+// foreign keys reference, references to other tables are ignored.
+func sortByDependency(tables []*schema.Schema) ([]*schema.Schema, error) {
+	byName := make(map[string]*schema.Schema)
+	for _, table := range tables {
+		byName[table.Name] = table
+	}
+
+	const (
+		visiting = iota + 1
+		visited
+	)
+	state := make(map[string]int)
+	var sorted []*schema.Schema
+	var visit func(table *schema.Schema) error
+	visit = func(table *schema.Schema) error {
+		switch state[table.Name] {
+		case visited:
+			return nil
+		case visiting:
+			return fmt.Errorf("foreign keys of table %s form a cycle", table.Name)
+		}
+		state[table.Name] = visiting
+		for _, fk := range table.ForeignKeys {
+			if ref := byName[fk.RefTable]; ref != nil && ref != table {
+				if err := visit(ref); err != nil {
+					return err
+				}
+			}
+		}
+		state[table.Name] = visited
+		sorted = append(sorted, table)
+		return nil
+	}
+
+	for _, table := range tables {
+		if err := visit(table); err != nil {
+			return nil, err
+		}
+	}
+	return sorted, nil
+}
+
+// indexPlan returns the statements dropping the indexes the model no longer
+// declares and creating the missing ones. Indexes are matched by name, one
+// whose definition changed is dropped and created again.
+func (engine *Engine) indexPlan(table *schema.Schema, existing map[string]string) (plan []string) {
+	var names []string
+	for name := range existing {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if index := table.GetIndex(name); index == nil || index.Definition() != existing[name] {
+			plan = append(plan, engine.dislect.DropIndexSQL(table.Name, name))
+		}
+	}
+	for _, index := range table.Indexes {
+		if definition, ok := existing[index.Name]; !ok || index.Definition() != definition {
+			plan = append(plan, index.Definition())
+		}
+	}
+	return
+}
+
+func (engine *Engine) Migrate(values ...interface{}) error {
+	return engine.MigrateContext(context.Background(), values...)
+}
+
+// MigrateContext creates or alters the tables of values so they match their
+// models, in one transaction. Tables are created after the tables their
+// foreign keys reference.
+func (engine *Engine) MigrateContext(ctx context.Context, values ...interface{}) error {
+	// rebuilding a table drops it, which must neither fail nor cascade to
+	// the tables referencing it, so foreign keys are not enforced on the
+	// connection of the migration. Where they cannot be turned off, a
+	// referenced table is not rebuilt, see migrationPlan.
+	conn, err := engine.db.Conn(ctx)
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+	defer conn.Close()
+	if off := engine.dislect.ForeignKeyChecks(false); off != "" {
+		log.Info(off)
+		if _, err := conn.ExecContext(ctx, off); err != nil {
+			log.Error(err)
+			return err
 		}
-		rows, _ := s.Raw(fmt.Sprintf("SELECT * FROM %s LIMIT 1", table.Name)).QueryRows()
-		columns, _ := rows.Columns()
-		err = rows.Close()
+		defer func() {
+			on := engine.dislect.ForeignKeyChecks(true)
+			log.Info(on)
+			if _, err := conn.ExecContext(context.WithoutCancel(ctx), on); err != nil {
+				log.Error(err)
+				// never give the connection back to the pool unchecked
+				_ = conn.Raw(func(interface{}) error { return driver.ErrBadConn })
+			}
+		}()
+	}
+
+	s := session.New(conn, engine.dislect).WithCallbacks(engine.callbacks).WithContext(ctx)
+	_, err = s.Transaction(func(s *session.Session) (result interface{}, err error) {
+		plan, err := engine.migrationPlan(s, values)
 		if err != nil {
 			return
 		}
+		// one statement per Exec, drivers like MySQL reject multi statements
+		for _, sql := range plan {
+			if _, err = s.Raw(sql).Exec(); err != nil {
+				return
+			}
+		}
+		return
+	})
+	return err
+}
+
+func (engine *Engine) PlanMigration(values ...interface{}) ([]string, error) {
+	return engine.PlanMigrationContext(context.Background(), values...)
+}
+
+// PlanMigrationContext returns the statements Migrate would run, in order,
+// without changing the database.
+func (engine *Engine) PlanMigrationContext(ctx context.Context, values ...interface{}) ([]string, error) {
+	return engine.migrationPlan(engine.NewSessionContext(ctx), values)
+}
+
+// migrationPlan returns the statements migrating the tables of values, it
+// only reads the database through s.
+func (engine *Engine) migrationPlan(s *session.Session, values []interface{}) (plan []string, err error) {
+	var tables []*schema.Schema
+	for _, value := range values {
+		table := s.Model(value).RefTable()
+		if table == nil {
+			return nil, s.ModelError()
+		}
+		tables = append(tables, table)
+	}
+	if tables, err = sortByDependency(tables); err != nil {
+		return nil, err
+	}
+
+	for _, table := range tables {
+		s.Model(table.Model)
+		if !s.HasTable() {
+			log.Infof("Table %s doesn't exist", table.Name)
+			stmts, err := s.CreateTableSQL()
+			if err != nil {
+				return nil, err
+			}
+			plan = append(plan, stmts...)
+			continue
+		}
+		existing, err := s.Columns()
+		if err != nil {
+			return nil, err
+		}
+		var columns, changed []string
+		for _, c := range existing {
+			columns = append(columns, c.Name)
+			if f := table.GetField(c.Name); f != nil && columnChanged(f, c) {
+				changed = append(changed, c.Name)
+			}
+		}
 
 		addCols := difference(table.FieldNames, columns)
 		delCols := difference(columns, table.FieldNames)
-		log.Infof("Added cols: %v, Deleted cols: %v", addCols, delCols)
+		log.Infof("Added cols: %v, Deleted cols: %v, Changed cols: %v", addCols, delCols, changed)
 
-		for _, col := range addCols {
-			f := table.GetField(col)
-			_, err = s.Raw(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table.Name, f.Name, f.Type)).Exec()
+		// foreign keys cannot be added to an existing table portably either
+		fks, err := s.ForeignKeys()
+		if err != nil {
+			return nil, err
+		}
+		fksChanged := !sameForeignKeys(table.ForeignKeys, fks)
+
+		quote := engine.dislect.Quote
+		if len(delCols) == 0 && len(changed) == 0 && !fksChanged {
+			for _, col := range addCols {
+				f := table.GetField(col)
+				plan = append(plan, fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s", quote(table.Name), f.Definition()))
+			}
+			indexes, err := s.Indexes()
 			if err != nil {
-				return
+				return nil, err
 			}
+			plan = append(plan, engine.indexPlan(table, indexes)...)
+			continue
 		}
 
-		if len(delCols) == 0 {
-			return
+		// columns cannot be dropped or redefined portably, the table is
+		// rebuilt with its new definition and the data of the kept columns
+		if engine.dislect.ForeignKeyChecks(false) == "" {
+			referencing, err := s.ReferencingTables()
+			if err != nil {
+				return nil, err
+			}
+			if len(referencing) > 0 {
+				return nil, fmt.Errorf("migrate %s: the table must be rebuilt but %s reference it, "+
+					"drop their foreign keys first", table.Name, strings.Join(referencing, ", "))
+			}
 		}
+		tmp := quote("tmp_" + table.Name)
+		var fields []string
+		for _, name := range difference(table.FieldNames, addCols) {
+			fields = append(fields, quote(name))
+		}
+		fieldStr := strings.Join(fields, ",")
+		plan = append(plan,
+			fmt.Sprintf("CREATE TABLE %s (%s);", tmp, strings.Join(table.ColumnDefinitions(), ",")),
+			fmt.Sprintf("INSERT INTO %s (%s) SELECT %s FROM %s;", tmp, fieldStr, fieldStr, quote(table.Name)),
+		)
+		if auto := table.AutoIncrementField(); auto != nil {
+			if reset := engine.dislect.ResetAutoIncrementSQL("tmp_"+table.Name, auto.Column); reset != "" {
+				plan = append(plan, reset)
+			}
+		}
+		plan = append(plan,
+			fmt.Sprintf("DROP TABLE %s;", quote(table.Name)),
+			fmt.Sprintf("ALTER TABLE %s RENAME TO %s;", tmp, quote(table.Name)),
+		)
+		// the indexes were dropped with the old table
+		plan = append(plan, engine.indexPlan(table, nil)...)
+	}
 
-		tmp := "tmp_" + table.Name
-		fieldStr := strings.Join(table.FieldNames, ",")
-		s.Raw(fmt.Sprintf("CREATE TABLE %s AS SELECT %s FROM %s;", tmp, fieldStr, table.Name))
-		s.Raw(fmt.Sprintf("DROP TABLE %s;", table.Name))
-		s.Raw(fmt.Sprintf("ALTER TABLE %s RENAME TO %s;", tmp, table.Name))
-		_, err = s.Exec()
-		return
-	})
-	return err
+	// join tables reference both sides, they come once every table exists
+	planned := make(map[string]bool)
+	for _, table := range tables {
+		joins, err := s.Model(table.Model).JoinTables()
+		if err != nil {
+			return nil, err
+		}
+		for _, join := range joins {
+			if planned[join.Name] || engine.tableExists(s, join.Name) {
+				continue
+			}
+			planned[join.Name] = true
+			log.Infof("Join table %s doesn't exist", join.Name)
+			plan = append(plan, fmt.Sprintf("CREATE TABLE %s (%s);", engine.dislect.Quote(join.Name), strings.Join(join.ColumnDefinitions(), ",")))
+		}
+	}
+	return plan, nil
+}
+
+func (engine *Engine) tableExists(s *session.Session, name string) bool {
+	sql, values := engine.dislect.TableExistSQL(name)
+	var tmp string
+	_ = s.Raw(sql, values...).ScanRow(&tmp)
+	return tmp == name
 }
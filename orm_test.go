@@ -1,9 +1,15 @@
 package orm
 
 import (
+	"context"
+	"database/sql"
 	"errors"
+	"path/filepath"
 	"reflect"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"orm/session"
 
@@ -72,6 +78,118 @@ func transactionCommit(t *testing.T) {
 	}
 }
 
+func TestEngineNestedTransaction(t *testing.T) {
+	engine := OpenDB(t)
+	defer engine.Close()
+	s := engine.NewSession().Model(&User{})
+	_ = s.DropTable()
+	_ = s.CreateTable()
+
+	_, err := engine.Transaction(func(s *session.Session) (interface{}, error) {
+		if _, err := s.Insert(&User{Name: "Tom", Age: 18}); err != nil {
+			return nil, err
+		}
+		// the failed inner unit only rolls back to its savepoint
+		_, inner := s.Transaction(func(s *session.Session) (interface{}, error) {
+			_, _ = s.Insert(&User{Name: "Sam", Age: 25})
+			return nil, errors.New("Error")
+		})
+		if inner == nil {
+			return nil, errors.New("inner transaction should fail")
+		}
+		return s.Transaction(func(s *session.Session) (interface{}, error) {
+			return s.Insert(&User{Name: "Jack", Age: 20})
+		})
+	})
+
+	var users []User
+	_ = s.OrderBy("Name").Find(&users)
+	if err != nil || len(users) != 2 || users[0].Name != "Jack" || users[1].Name != "Tom" {
+		t.Fatal("failed to nest transactions", err, users)
+	}
+}
+
+func TestEngineTransactionRetry(t *testing.T) {
+	engine := OpenDB(t)
+	defer engine.Close()
+	s := engine.NewSession().Model(&User{})
+	_ = s.DropTable()
+	_ = s.CreateTable()
+
+	runs := 0
+	opts := TxOptions{Retries: 3, Backoff: time.Millisecond}
+	_, err := engine.TransactionOptions(context.Background(), opts, func(s *session.Session) (interface{}, error) {
+		if _, err := s.Insert(&User{Name: "Tom", Age: 18}); err != nil {
+			return nil, err
+		}
+		if runs++; runs < 3 {
+			return nil, errors.New("database is locked")
+		}
+		return nil, nil
+	})
+	count, _ := s.Count()
+	if err != nil || runs != 3 || count != 1 {
+		t.Fatal("failed to retry the transaction", err, runs, count)
+	}
+
+	runs = 0
+	_, err = engine.TransactionOptions(context.Background(), opts, func(s *session.Session) (interface{}, error) {
+		runs++
+		return nil, errors.New("Error")
+	})
+	if err == nil || runs != 1 {
+		t.Fatal("expect no retry of a non-retryable error, got runs", runs)
+	}
+}
+
+type Counter struct {
+	ID    int `orm:"primary key"`
+	Value int
+}
+
+func TestEngineTransactionConcurrentWriters(t *testing.T) {
+	// no busy timeout, so contended writers fail with SQLITE_BUSY at once
+	engine, err := NewEngine("sqlite3", filepath.Join(t.TempDir(), "counter.db")+"?_busy_timeout=0")
+	if err != nil {
+		t.Fatal("failed to connect", err)
+	}
+	defer engine.Close()
+	s := engine.NewSession().Model(&Counter{})
+	_ = s.CreateTable()
+	_, _ = s.Insert(&Counter{ID: 1})
+
+	const writers = 8
+	opts := TxOptions{Isolation: sql.LevelSerializable, Retries: 100, Backoff: time.Millisecond}
+	var wg sync.WaitGroup
+	errs := make(chan error, writers)
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := engine.TransactionOptions(context.Background(), opts, func(s *session.Session) (interface{}, error) {
+				var c Counter
+				if err := s.Get(&c, 1); err != nil {
+					return nil, err
+				}
+				return s.Model(&Counter{}).Where("ID = ?", 1).Update("Value", c.Value+1)
+			})
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal("failed to retry a busy transaction", err)
+		}
+	}
+
+	var c Counter
+	if err := engine.NewSession().Get(&c, 1); err != nil || c.Value != writers {
+		t.Fatal("expect every writer to increment the counter, got", c.Value, err)
+	}
+}
+
 func TestEngine(t *testing.T) {
 	t.Run("alias table name", func(t *testing.T) {
 		aliasTableNames(t)
@@ -107,3 +225,321 @@ func TestEngineMigrate(t *testing.T) {
 		t.Fatal("Failed to migrate table User, got columns", cols)
 	}
 }
+
+type Account struct {
+	Name    string `orm:"primary key"`
+	Balance int    `orm:"not null;default:0"`
+}
+
+func TestEngineMigrateColumnChanges(t *testing.T) {
+	engine := OpenDB(t)
+	defer engine.Close()
+	s := engine.NewSession()
+	_, _ = s.Raw(`DROP TABLE IF EXISTS "Account";`).Exec()
+	_, _ = s.Raw(`CREATE TABLE "Account" ("Name" text PRIMARY KEY, "Balance" text);`).Exec()
+	_, _ = s.Raw(`INSERT INTO "Account" VALUES (?, ?), (?, ?)`, "Tom", "12", "Sam", "30").Exec()
+
+	if err := engine.Migrate(&Account{}); err != nil {
+		t.Fatal(err)
+	}
+	columns, err := s.Model(&Account{}).Columns()
+	for i := range columns {
+		columns[i].Type = strings.ToLower(columns[i].Type)
+	}
+	want := []session.Column{
+		{Name: "Name", Type: "text", PrimaryKey: true},
+		{Name: "Balance", Type: "integer", NotNull: true, Default: sql.NullString{String: "0", Valid: true}},
+	}
+	if err != nil || !reflect.DeepEqual(columns, want) {
+		t.Fatal("failed to migrate column changes, got", columns, err)
+	}
+
+	var accounts []Account
+	_ = s.OrderBy("Name").Find(&accounts)
+	if len(accounts) != 2 || accounts[0] != (Account{"Sam", 30}) || accounts[1] != (Account{"Tom", 12}) {
+		t.Fatal("failed to keep the data of changed columns, got", accounts)
+	}
+
+	plan, err := engine.PlanMigration(&Account{})
+	if err != nil || len(plan) != 0 {
+		t.Fatal("expect nothing to migrate once columns match, got", plan, err)
+	}
+}
+
+type Subscriber struct {
+	ID    int `orm:"primary key"`
+	Email string
+}
+
+type UniqueSubscriber struct {
+	ID    int    `orm:"primary key"`
+	Email string `orm:"unique"`
+}
+
+func (u *UniqueSubscriber) TableName() string { return "Subscriber" }
+
+func TestEngineMigrateUniqueColumn(t *testing.T) {
+	engine := OpenDB(t)
+	defer engine.Close()
+	s := engine.NewSession()
+	_, _ = s.Raw(`DROP TABLE IF EXISTS "Subscriber";`).Exec()
+	if err := engine.Migrate(&Subscriber{}); err != nil {
+		t.Fatal(err)
+	}
+
+	plan, err := engine.PlanMigration(&UniqueSubscriber{})
+	if err != nil || len(plan) == 0 {
+		t.Fatal("expect the unique constraint to be migrated, got", plan, err)
+	}
+	if err := engine.Migrate(&UniqueSubscriber{}); err != nil {
+		t.Fatal(err)
+	}
+	columns, err := s.Model(&UniqueSubscriber{}).Columns()
+	if err != nil || len(columns) != 2 || !columns[1].Unique {
+		t.Fatal("failed to make Email unique, got", columns, err)
+	}
+	if plan, err = engine.PlanMigration(&UniqueSubscriber{}); err != nil || len(plan) != 0 {
+		t.Fatal("expect nothing to migrate once columns match, got", plan, err)
+	}
+	if plan, err = engine.PlanMigration(&Subscriber{}); err != nil || len(plan) == 0 {
+		t.Fatal("expect the unique constraint to be dropped, got", plan, err)
+	}
+}
+
+type Member struct {
+	ID    int    `orm:"primary key"`
+	Email string `orm:"unique index"`
+	Team  string `orm:"index:idx_team_role"`
+	Role  string `orm:"index:idx_team_role"`
+}
+
+func TestEngineMigrateIndexes(t *testing.T) {
+	engine := OpenDB(t)
+	defer engine.Close()
+	s := engine.NewSession().Model(&Member{})
+	_ = s.DropTable()
+	_, _ = s.Raw(`CREATE TABLE "Member" ("ID" integer PRIMARY KEY,"Email" text,"Team" text,"Role" text);`).Exec()
+	_, _ = s.Raw(`CREATE INDEX "idx_stale" ON "Member" ("Role")`).Exec()
+	_, _ = s.Raw(`CREATE INDEX "idx_team_role" ON "Member" ("Team")`).Exec()
+
+	plan, err := engine.PlanMigration(&Member{})
+	want := []string{
+		`DROP INDEX "idx_stale"`,
+		`DROP INDEX "idx_team_role"`,
+		`CREATE UNIQUE INDEX "idx_Member_Email" ON "Member" ("Email")`,
+		`CREATE INDEX "idx_team_role" ON "Member" ("Team", "Role")`,
+	}
+	if err != nil || !reflect.DeepEqual(plan, want) {
+		t.Fatal("failed to plan index changes, got", plan, err)
+	}
+	if err := engine.Migrate(&Member{}); err != nil {
+		t.Fatal(err)
+	}
+	if indexes, _ := s.Model(&Member{}).Indexes(); len(indexes) != 2 || indexes["idx_team_role"] != want[3] {
+		t.Fatal("failed to migrate indexes, got", indexes)
+	}
+	if plan, err := engine.PlanMigration(&Member{}); err != nil || len(plan) != 0 {
+		t.Fatal("expect nothing to migrate once indexes match, got", plan, err)
+	}
+
+	// CreateTable creates the indexes as well
+	_ = s.DropTable()
+	if err := s.CreateTable(); err != nil {
+		t.Fatal(err)
+	}
+	_, _ = s.Insert(&Member{ID: 1, Email: "tom@example.com"})
+	if _, err := s.Insert(&Member{ID: 2, Email: "tom@example.com"}); err == nil {
+		t.Fatal("expect the unique index to reject a duplicate email")
+	}
+}
+
+type Author struct {
+	ID   int `orm:"primary key"`
+	Name string
+}
+
+type Book struct {
+	ID       int `orm:"primary key"`
+	AuthorID int `orm:"references:Author.ID;on delete:cascade"`
+	Title    string
+}
+
+func TestEngineMigrateForeignKeys(t *testing.T) {
+	engine := OpenDB(t)
+	defer engine.Close()
+	s := engine.NewSession()
+	_ = s.Model(&Book{}).DropTable()
+	_ = s.Model(&Author{}).DropTable()
+
+	// Book is created after the Author it references
+	plan, _ := engine.PlanMigration(&Book{}, &Author{})
+	if len(plan) != 2 || !strings.HasPrefix(plan[0], `CREATE TABLE "Author"`) ||
+		!strings.HasSuffix(plan[1], `FOREIGN KEY ("AuthorID") REFERENCES "Author" ("ID") ON DELETE CASCADE);`) {
+		t.Fatal("failed to order tables by dependency, got", plan)
+	}
+	if err := engine.Migrate(&Book{}, &Author{}); err != nil {
+		t.Fatal(err)
+	}
+
+	_, _ = s.Insert(&Author{ID: 1, Name: "Tom"})
+	_, _ = s.Insert(&Book{ID: 1, AuthorID: 1, Title: "Go"})
+	if _, err := s.Insert(&Book{ID: 2, AuthorID: 2, Title: "SQL"}); err == nil {
+		t.Fatal("expect foreign keys to be enforced")
+	}
+
+	// rebuilding the referenced table keeps the books
+	_, _ = s.Raw(`ALTER TABLE "Author" ADD COLUMN "Legacy" integer`).Exec()
+	if err := engine.Migrate(&Author{}, &Book{}); err != nil {
+		t.Fatal(err)
+	}
+	if count, _ := s.Model(&Book{}).Count(); count != 1 {
+		t.Fatal("rebuilding Author deleted its books, got", count)
+	}
+
+	if _, err := s.DeleteModel(&Author{ID: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if count, _ := s.Model(&Book{}).Count(); count != 0 {
+		t.Fatal("failed to cascade the delete, got books", count)
+	}
+}
+
+type Reader struct {
+	ID    int    `orm:"primary key"`
+	Books []Book `orm:"many2many:reader_books"`
+}
+
+func TestEngineMigrateJoinTables(t *testing.T) {
+	engine := OpenDB(t)
+	defer engine.Close()
+	s := engine.NewSession()
+	_, _ = s.Raw(`DROP TABLE IF EXISTS "reader_books";`).Exec()
+	_ = s.Model(&Reader{}).DropTable()
+	_ = s.Model(&Book{}).DropTable()
+	_ = s.Model(&Author{}).DropTable()
+
+	// the join table comes after both tables it references
+	plan, _ := engine.PlanMigration(&Reader{}, &Book{}, &Author{})
+	if len(plan) != 4 || !strings.HasPrefix(plan[3], `CREATE TABLE "reader_books" ("ReaderID" integer,"BookID" integer,PRIMARY KEY ("ReaderID", "BookID")`) {
+		t.Fatal("failed to plan the join table, got", plan)
+	}
+	if err := engine.Migrate(&Reader{}, &Book{}, &Author{}); err != nil {
+		t.Fatal(err)
+	}
+	if plan, err := engine.PlanMigration(&Reader{}, &Book{}, &Author{}); err != nil || len(plan) != 0 {
+		t.Fatal("expect nothing left to migrate, got", plan, err)
+	}
+
+	_, _ = s.Insert(&Author{ID: 1, Name: "Tom"})
+	tom := &Reader{ID: 1}
+	book := &Book{ID: 1, AuthorID: 1, Title: "Go"}
+	_, _ = s.Insert(tom)
+	_, _ = s.Insert(book)
+	if err := s.Association(tom, "Books").Append(book); err != nil {
+		t.Fatal(err)
+	}
+	var readers []Reader
+	if err := s.Preload("Books").Find(&readers); err != nil || len(readers) != 1 || len(readers[0].Books) != 1 {
+		t.Fatal("failed to preload the books of the reader", readers, err)
+	}
+}
+
+func TestEnginePlanMigration(t *testing.T) {
+	engine := OpenDB(t)
+	defer engine.Close()
+	s := engine.NewSession()
+	_, _ = s.Raw("drop table if exists users;").Exec()
+	_, _ = s.Raw("CREATE TABLE users(Name text PRIMARY KEY, XXX integer);").Exec()
+	_ = s.Model(&Counter{}).DropTable()
+
+	plan, err := engine.PlanMigration(&User{}, &Counter{})
+	want := []string{
+		`CREATE TABLE "tmp_users" ("Name" text PRIMARY KEY,"Age" integer);`,
+		`INSERT INTO "tmp_users" ("Name") SELECT "Name" FROM "users";`,
+		`DROP TABLE "users";`,
+		`ALTER TABLE "tmp_users" RENAME TO "users";`,
+		`CREATE TABLE "Counter" ("ID" integer PRIMARY KEY,"Value" integer);`,
+	}
+	if err != nil || !reflect.DeepEqual(plan, want) {
+		t.Fatalf("expect plan\n%s\ngot\n%s %v", strings.Join(want, "\n"), strings.Join(plan, "\n"), err)
+	}
+
+	rows, _ := s.Raw("SELECT * FROM users").QueryRows()
+	cols, _ := rows.Columns()
+	_ = rows.Close()
+	if !reflect.DeepEqual(cols, []string{"Name", "XXX"}) || s.Model(&Counter{}).HasTable() {
+		t.Fatal("planning a migration changed the database, got columns", cols)
+	}
+}
+
+func TestEngineTransactionContext(t *testing.T) {
+	engine := OpenDB(t)
+	defer engine.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	called := false
+	_, err := engine.TransactionContext(ctx, func(s *session.Session) (interface{}, error) {
+		called = true
+		return nil, nil
+	})
+	if err == nil || called {
+		t.Fatal("expect a cancelled context to abort the transaction")
+	}
+
+	if err := engine.MigrateContext(ctx, &User{}); err == nil {
+		t.Fatal("expect a cancelled context to abort the migration")
+	}
+}
+
+type Audit struct {
+	Name string `orm:"primary key"`
+}
+
+func (a *Audit) AfterInsert(s *session.Session) error {
+	if a.Name == "" {
+		return errors.New("empty audit")
+	}
+	return nil
+}
+
+func TestEngineTransactionHookRollback(t *testing.T) {
+	engine := OpenDB(t)
+	defer engine.Close()
+	s := engine.NewSession().Model(&Audit{})
+	_ = s.DropTable()
+	_ = s.CreateTable()
+
+	_, err := engine.Transaction(func(s *session.Session) (interface{}, error) {
+		if _, err := s.Insert(&Audit{Name: "ok"}); err != nil {
+			return nil, err
+		}
+		return s.Insert(&Audit{})
+	})
+	count, _ := s.Count()
+	if err == nil || count != 0 {
+		t.Fatal("failed to roll back after a hook error, got records", count)
+	}
+}
+
+func TestEngineCallbacks(t *testing.T) {
+	engine := OpenDB(t)
+	defer engine.Close()
+
+	var ops []session.Operation
+	engine.Callbacks().Register(session.OpCreate, session.AfterStatement, "test", 0, func(s *session.Session) error {
+		ops = append(ops, s.Operation())
+		return nil
+	})
+
+	s := engine.NewSession().Model(&User{})
+	_ = s.DropTable()
+	_ = s.CreateTable()
+	_, _ = engine.Transaction(func(s *session.Session) (interface{}, error) {
+		return s.Insert(&User{Name: "Tom", Age: 18})
+	})
+	if len(ops) != 1 || ops[0] != session.OpCreate {
+		t.Fatal("failed to run engine callbacks, got", ops)
+	}
+}
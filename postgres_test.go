@@ -0,0 +1,102 @@
+package orm
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"strings"
+	"testing"
+
+	"orm/dialect"
+)
+
+var postgresRecorder = &recorder{}
+
+func init() {
+	sql.Register("postgres", postgresRecorder)
+}
+
+func openPostgres(t *testing.T, rows func(query string) ([]string, [][]driver.Value)) *Engine {
+	t.Helper()
+	engine, err := NewEngine("postgres", "recorder")
+	if err != nil || engine == nil {
+		t.Fatal("failed to connect", err)
+	}
+	postgresRecorder.reset(rows)
+	return engine
+}
+
+func TestPostgresInsertReturning(t *testing.T) {
+	// the recorder reports 1 through LastInsertId, the key must come from
+	// the RETURNING clause instead
+	engine := openPostgres(t, func(query string) ([]string, [][]driver.Value) {
+		return []string{"ID"}, [][]driver.Value{{int64(7)}}
+	})
+	defer engine.Close()
+
+	order := &Order{Customer: "Tom", Total: 9.5}
+	if n, err := engine.NewSession().Insert(order); err != nil || n != 1 || order.ID != 7 {
+		t.Fatal("failed to read the generated key", n, order.ID, err)
+	}
+	expectStatements(t, postgresRecorder,
+		`INSERT INTO "Order" ("Customer","Total","Note","Tags") VALUES ($1, $2, $3, $4) RETURNING "ID"`)
+}
+
+var (
+	postgresDialect, _              = dialect.GetDialect("postgres")
+	postgresTableExistSQL, _        = postgresDialect.TableExistSQL("Order")
+	postgresColumnsSQL, _           = postgresDialect.ColumnsSQL("Order")
+	postgresForeignKeysSQL, _       = postgresDialect.ForeignKeysSQL("Order")
+	postgresReferencingTablesSQL, _ = postgresDialect.ReferencingTablesSQL("Order")
+)
+
+// postgresOrder answers the queries of a migration of Order, whose table has
+// a Legacy column and is referenced by the referencing tables.
+func postgresOrder(referencing ...string) func(query string) ([]string, [][]driver.Value) {
+	return func(query string) ([]string, [][]driver.Value) {
+		switch strings.TrimSpace(query) {
+		case postgresTableExistSQL:
+			return []string{"table_name"}, [][]driver.Value{{"Order"}}
+		case postgresColumnsSQL:
+			return orderColumns("Legacy")
+		case postgresReferencingTablesSQL:
+			var rows [][]driver.Value
+			for _, name := range referencing {
+				rows = append(rows, []driver.Value{name})
+			}
+			return []string{"name"}, rows
+		}
+		return nil, nil
+	}
+}
+
+func TestPostgresMigrateRebuild(t *testing.T) {
+	engine := openPostgres(t, postgresOrder())
+	defer engine.Close()
+
+	if err := engine.Migrate(&Order{}); err != nil {
+		t.Fatal(err)
+	}
+	expectStatements(t, postgresRecorder,
+		postgresTableExistSQL, postgresColumnsSQL, postgresForeignKeysSQL, postgresReferencingTablesSQL,
+		`CREATE TABLE "tmp_Order" ("ID" bigserial PRIMARY KEY,"Customer" varchar(64) NOT NULL,`+
+			`"Total" double precision,"Note" text,"Tags" bytea);`,
+		`INSERT INTO "tmp_Order" ("ID","Customer","Total","Note") SELECT "ID","Customer","Total","Note" FROM "Order";`,
+		`SELECT setval(pg_get_serial_sequence('"tmp_Order"', 'ID'), COALESCE(MAX("ID"), 0) + 1, false) FROM "tmp_Order"`,
+		`DROP TABLE "Order";`,
+		`ALTER TABLE "tmp_Order" RENAME TO "Order";`)
+}
+
+func TestPostgresMigrateReferencedTable(t *testing.T) {
+	engine := openPostgres(t, postgresOrder("Payment"))
+	defer engine.Close()
+
+	err := engine.Migrate(&Order{})
+	if err == nil || !strings.Contains(err.Error(), "Payment") {
+		t.Fatal("expect an error rebuilding a referenced table, got", err)
+	}
+	for _, stmt := range postgresRecorder.statements() {
+		if strings.HasPrefix(stmt, "DROP TABLE") {
+			t.Fatal("expect the referenced table to be kept, got", stmt)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package schema
+
+import (
+	"fmt"
+	"strings"
+
+	"orm/dialect"
+)
+
+// ForeignKey is a foreign key of a table, declared with the references tag
+// and the optional on delete and on update tags.
+type ForeignKey struct {
+	Column    string
+	RefTable  string
+	RefColumn string
+	// OnDelete and OnUpdate are the referential actions, e.g. CASCADE, empty
+	// for the default NO ACTION
+	OnDelete string
+	OnUpdate string
+
+	definition string
+}
+
+var referentialActions = []string{"CASCADE", "SET NULL", "SET DEFAULT", "RESTRICT", "NO ACTION"}
+
+// referentialAction normalizes an action, "set_null" and "Set Null" are
+// SET NULL.
+func referentialAction(action string) (string, bool) {
+	action = strings.Join(strings.Fields(strings.ToUpper(strings.ReplaceAll(action, "_", " "))), " ")
+	for _, a := range referentialActions {
+		if a == action {
+			return a, true
+		}
+	}
+	return "", false
+}
+
+// Definition returns the table constraint of the foreign key, e.g.
+// FOREIGN KEY ("UserID") REFERENCES "users" ("ID") ON DELETE CASCADE.
+func (fk *ForeignKey) Definition() string {
+	return fk.definition
+}
+
+func (fk *ForeignKey) define(d dialect.Dialect) string {
+	def := fmt.Sprintf("FOREIGN KEY (%s) REFERENCES %s (%s)", d.Quote(fk.Column), d.Quote(fk.RefTable), d.Quote(fk.RefColumn))
+	if fk.OnDelete != "" {
+		def += " ON DELETE " + fk.OnDelete
+	}
+	if fk.OnUpdate != "" {
+		def += " ON UPDATE " + fk.OnUpdate
+	}
+	return def
+}
+
+// Equal reports whether fk and other constrain the same column the same way,
+// actions are compared normalized and an empty action equals NO ACTION.
+func (fk *ForeignKey) Equal(other *ForeignKey) bool {
+	action := func(a string) string {
+		if a, ok := referentialAction(a); ok {
+			return a
+		}
+		return "NO ACTION"
+	}
+	return fk.Column == other.Column && fk.RefTable == other.RefTable && fk.RefColumn == other.RefColumn &&
+		action(fk.OnDelete) == action(other.OnDelete) && action(fk.OnUpdate) == action(other.OnUpdate)
+}
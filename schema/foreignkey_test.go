@@ -0,0 +1,41 @@
+package schema
+
+import "testing"
+
+type Purchase struct {
+	ID       int    `orm:"primary key"`
+	UserName string `orm:"references:users.Name;on delete:cascade;on update:set_null"`
+	ItemID   int    `orm:"column:item_id;references:items.ID"`
+}
+
+func TestParseForeignKeys(t *testing.T) {
+	schema, err := Parse(&Purchase{}, TestDial)
+	if err != nil || len(schema.ForeignKeys) != 2 {
+		t.Fatal("failed to parse foreign keys", err)
+	}
+
+	fk := schema.ForeignKeys[0]
+	if fk.Column != "UserName" || fk.RefTable != "users" || fk.RefColumn != "Name" ||
+		fk.OnDelete != "CASCADE" || fk.OnUpdate != "SET NULL" {
+		t.Fatalf("failed to parse foreign key, got %+v", fk)
+	}
+	if schema.ForeignKeys[1].Column != "item_id" {
+		t.Fatal("expect the foreign key on the column name, got", schema.ForeignKeys[1].Column)
+	}
+
+	defs := schema.ColumnDefinitions()
+	want := []string{
+		`FOREIGN KEY ("UserName") REFERENCES "users" ("Name") ON DELETE CASCADE ON UPDATE SET NULL`,
+		`FOREIGN KEY ("item_id") REFERENCES "items" ("ID")`,
+	}
+	for i, def := range defs[3:] {
+		if def != want[i] {
+			t.Fatalf("expect definition %q, got %q", want[i], def)
+		}
+	}
+
+	same := &ForeignKey{Column: "item_id", RefTable: "items", RefColumn: "ID", OnDelete: "no action", OnUpdate: "NO ACTION"}
+	if !schema.ForeignKeys[1].Equal(same) || schema.ForeignKeys[0].Equal(same) {
+		t.Fatal("failed to compare foreign keys")
+	}
+}
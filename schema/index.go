@@ -0,0 +1,109 @@
+package schema
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"orm/dialect"
+)
+
+// Index is an index of a table. Indexes are declared with the index and
+// unique index tags, fields sharing an index name make a composite index in
+// field order, or by the Indexes method of the model for what tags cannot
+// express, such as partial indexes.
+type Index struct {
+	Name    string
+	Columns []string // column names, in index order
+	Unique  bool
+	// Where makes a partial index of the records matching the condition,
+	// e.g. "Active = 1". MySQL does not support partial indexes. Migrations
+	// compare it with the condition as the database prints it, a condition
+	// written differently makes the index be created again.
+	Where string
+
+	definition string
+}
+
+// IIndexes is implemented by models declaring indexes with a method.
+type IIndexes interface {
+	Indexes() []Index
+}
+
+// Definition returns the CREATE INDEX statement of the index, e.g.
+// CREATE UNIQUE INDEX "idx_email" ON "users" ("Email").
+func (index *Index) Definition() string {
+	return index.definition
+}
+
+// fieldIndex is an index or unique index tag, name is empty when omitted.
+type fieldIndex struct {
+	name   string
+	unique bool
+}
+
+// GetIndex returns the index named name, or nil.
+func (schema *Schema) GetIndex(name string) *Index {
+	for _, index := range schema.Indexes {
+		if index.Name == name {
+			return index
+		}
+	}
+	return nil
+}
+
+func (schema *Schema) parseIndexes(modelType reflect.Type, d dialect.Dialect) error {
+	model := modelType.Name()
+	for _, field := range schema.Fields {
+		for _, tag := range field.indexes {
+			name := tag.name
+			if name == "" {
+				name = fmt.Sprintf("idx_%s_%s", schema.Name, field.Column)
+			}
+			index := schema.GetIndex(name)
+			if index == nil {
+				index = &Index{Name: name, Unique: tag.unique}
+				schema.Indexes = append(schema.Indexes, index)
+			} else if index.Unique != tag.unique {
+				return fmt.Errorf("schema: %s.%s: index %q is both unique and not unique", model, field.Name, name)
+			}
+			index.Columns = append(index.Columns, field.Column)
+		}
+	}
+
+	if t, ok := reflect.New(modelType).Interface().(IIndexes); ok {
+		for _, declared := range t.Indexes() {
+			index := declared
+			index.Columns = append([]string(nil), declared.Columns...)
+			if index.Name == "" || len(index.Columns) == 0 {
+				return fmt.Errorf("schema: %s: index %q needs a name and columns", model, index.Name)
+			}
+			if schema.GetIndex(index.Name) != nil {
+				return fmt.Errorf("schema: %s: duplicate index %q", model, index.Name)
+			}
+			for _, column := range index.Columns {
+				if schema.GetField(column) == nil {
+					return fmt.Errorf("schema: %s: index %q: unknown column %q", model, index.Name, column)
+				}
+			}
+			schema.Indexes = append(schema.Indexes, &index)
+		}
+	}
+
+	for _, index := range schema.Indexes {
+		var columns []string
+		for _, column := range index.Columns {
+			columns = append(columns, d.Quote(column))
+		}
+		sql := "CREATE INDEX"
+		if index.Unique {
+			sql = "CREATE UNIQUE INDEX"
+		}
+		sql = fmt.Sprintf("%s %s ON %s (%s)", sql, d.Quote(index.Name), d.Quote(schema.Name), strings.Join(columns, ", "))
+		if index.Where != "" {
+			sql += " WHERE " + index.Where
+		}
+		index.definition = sql
+	}
+	return nil
+}
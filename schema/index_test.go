@@ -0,0 +1,76 @@
+package schema
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type Customer struct {
+	ID       int    `orm:"primary key"`
+	TenantID int    `orm:"unique index:idx_tenant_email"`
+	Email    string `orm:"unique index:idx_tenant_email"`
+	Name     string `orm:"index"`
+	Active   bool
+}
+
+func (c *Customer) Indexes() []Index {
+	return []Index{{Name: "idx_active_name", Columns: []string{"Name"}, Where: `"Active" = 1`}}
+}
+
+func TestParseIndexes(t *testing.T) {
+	schema, err := Parse(&Customer{}, TestDial)
+	if err != nil || len(schema.Indexes) != 3 {
+		t.Fatal("failed to parse indexes", err)
+	}
+
+	composite := schema.GetIndex("idx_tenant_email")
+	if composite == nil || !composite.Unique || !reflect.DeepEqual(composite.Columns, []string{"TenantID", "Email"}) {
+		t.Fatal("failed to parse composite unique index", composite)
+	}
+
+	want := []string{
+		`CREATE UNIQUE INDEX "idx_tenant_email" ON "Customer" ("TenantID", "Email")`,
+		`CREATE INDEX "idx_Customer_Name" ON "Customer" ("Name")`,
+		`CREATE INDEX "idx_active_name" ON "Customer" ("Name") WHERE "Active" = 1`,
+	}
+	for i, index := range schema.Indexes {
+		if got := index.Definition(); got != want[i] {
+			t.Fatalf("expect definition %q, got %q", want[i], got)
+		}
+	}
+}
+
+type badIndexes struct {
+	Name string
+}
+
+func (b *badIndexes) Indexes() []Index {
+	return []Index{{Name: "idx_bad", Columns: []string{"Missing"}}}
+}
+
+func TestParseIndexError(t *testing.T) {
+	tests := []struct {
+		name  string
+		model interface{}
+		err   string
+	}{
+		{"unique and not unique", &struct {
+			A int `orm:"index:idx_ab"`
+			B int `orm:"unique index:idx_ab"`
+		}{}, `both unique and not unique`},
+		{"invalid name", &struct {
+			A int `orm:"index:idx a"`
+		}{}, `invalid index name`},
+		{"unknown column", &badIndexes{}, `unknown column "Missing"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(tt.model, TestDial)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("expect error containing %q, got %v", tt.err, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,277 @@
+package schema
+
+import (
+	"database/sql"
+	"fmt"
+	"go/ast"
+	"reflect"
+	"strings"
+	"time"
+
+	"orm/dialect"
+)
+
+type RelationshipKind int
+
+const (
+	// HasOne is a struct field whose model holds the key of the owner,
+	// e.g. User.Profile with Profile.UserID.
+	HasOne RelationshipKind = iota + 1
+	// HasMany is a slice field whose models hold the key of the owner,
+	// e.g. User.Orders with Order.UserID.
+	HasMany
+	// BelongsTo is a struct field whose key the owner holds, e.g.
+	// Order.User with Order.UserID.
+	BelongsTo
+	// ManyToMany is a slice field whose models are linked to the owner by
+	// the rows of a join table, e.g. User.Roles with user_roles.
+	ManyToMany
+)
+
+// Relationship is an association field of a model. Association fields are
+// not columns, they are loaded with Session.Preload.
+//
+// The keys default to the conventional names, the owner type name followed
+// by its primary key for HasOne and HasMany, e.g. UserID, and the field name
+// followed by the primary key of the associated model for BelongsTo, e.g.
+// CompanyID. The tags override them:
+//
+//	Orders []Order `orm:"foreign key:BuyerID;references:ID"`
+//
+// A ManyToMany field names its join table, whose columns are the owner type
+// name and the associated type name followed by their primary keys, e.g.
+// UserID and RoleID:
+//
+//	Roles []Role `orm:"many2many:user_roles"`
+type Relationship struct {
+	Name string // name of the association field
+	Kind RelationshipKind
+	Type reflect.Type // struct type of the associated model
+	// ForeignKey is the field holding the key, on the associated model for
+	// HasOne and HasMany and on the owner for BelongsTo. References is the
+	// field it refers to, on the other side. For ManyToMany, References is
+	// the key of the owner and ForeignKey the key of the associated model.
+	ForeignKey string
+	References string
+	// JoinTable of a ManyToMany association, whose JoinForeignKey column
+	// holds the key of the owner and JoinReferences the associated key
+	JoinTable      string
+	JoinForeignKey string
+	JoinReferences string
+}
+
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	nullTimeType = reflect.TypeOf(sql.NullTime{})
+	scannerType  = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+)
+
+// isNullableTime reports whether typ is a *time.Time or a sql.NullTime,
+// which hold NULL as nil and invalid.
+func isNullableTime(typ reflect.Type) bool {
+	return typ == nullTimeType || typ.Kind() == reflect.Ptr && typ.Elem() == timeType
+}
+
+func isTime(typ reflect.Type) bool {
+	return typ == timeType || isNullableTime(typ)
+}
+
+// associationType returns the struct type of an association field, User,
+// *User, []User or []*User, or nil for a column.
+func associationType(typ reflect.Type) (elem reflect.Type, many bool) {
+	if typ.Kind() == reflect.Slice {
+		typ, many = typ.Elem(), true
+	}
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if typ.Kind() != reflect.Struct || typ == timeType || reflect.PtrTo(typ).Implements(scannerType) {
+		return nil, false
+	}
+	return typ, many
+}
+
+// GetRelationship returns the association field name, or nil.
+func (schema *Schema) GetRelationship(name string) *Relationship {
+	for _, rel := range schema.Relationships {
+		if rel.Name == name {
+			return rel
+		}
+	}
+	return nil
+}
+
+// LookUpField returns the field of the struct field name, or nil.
+func (schema *Schema) LookUpField(name string) *Field {
+	for _, field := range schema.Fields {
+		if field.Name == name {
+			return field
+		}
+	}
+	return nil
+}
+
+// primaryKeyName returns the name of the first primary key field of typ,
+// read from the tags alone so models referring to each other parse.
+func primaryKeyName(typ reflect.Type) string {
+	for i := 0; i < typ.NumField(); i++ {
+		p := typ.Field(i)
+		if _, many := associationType(p.Type); p.Anonymous || !ast.IsExported(p.Name) || many {
+			continue
+		}
+		field := &Field{Name: p.Name, Column: p.Name}
+		if tag, ok := p.Tag.Lookup("orm"); ok && parseTag(field, p, typ.Name(), tag) == nil && field.PrimaryKey {
+			return p.Name
+		}
+	}
+	return ""
+}
+
+func hasField(typ reflect.Type, name string) bool {
+	_, ok := typ.FieldByName(name)
+	return name != "" && ok
+}
+
+// parseRelationship resolves the association field p of the model owner. A
+// field whose keys cannot be found is an error, so a typo does not silently
+// drop the association.
+func (schema *Schema) parseRelationship(owner reflect.Type, p reflect.StructField, elem reflect.Type, many bool) (*Relationship, error) {
+	fail := func(format string, args ...interface{}) error {
+		return fmt.Errorf("schema: %s.%s: %s", owner.Name(), p.Name, fmt.Sprintf(format, args...))
+	}
+
+	var foreignKey, references, joinTable string
+	tag, hasTag := p.Tag.Lookup("orm")
+	for _, option := range strings.Split(tag, ";") {
+		option = strings.TrimSpace(option)
+		if option == "" {
+			continue
+		}
+		key, value, _ := strings.Cut(option, ":")
+		value = strings.TrimSpace(value)
+		switch normalizeTagKey(key) {
+		case tagForeignKey:
+			foreignKey = value
+		case tagReferences:
+			references = value
+		case tagMany2Many:
+			if value == "" || strings.ContainsAny(value, " \t\"'`;,()") {
+				return nil, fail("many2many must name the join table, got %q", value)
+			}
+			joinTable = value
+		default:
+			return nil, fail("unknown association tag option %q", option)
+		}
+	}
+	explicit := hasTag && (foreignKey != "" || references != "")
+
+	var ownerKey string
+	if len(schema.PrimaryKeys) > 0 {
+		ownerKey = schema.PrimaryKeys[0].Name
+	}
+	rel := &Relationship{Name: p.Name, Type: elem}
+
+	if joinTable != "" {
+		return rel, schema.parseJoinTable(owner, p, rel, joinTable, foreignKey, references)
+	}
+
+	// BelongsTo when the owner holds the key
+	if !many {
+		rel.Kind, rel.ForeignKey, rel.References = BelongsTo, foreignKey, references
+		if rel.References == "" {
+			rel.References = primaryKeyName(elem)
+		}
+		if rel.ForeignKey == "" && rel.References != "" {
+			rel.ForeignKey = p.Name + rel.References
+		}
+		if hasField(owner, rel.ForeignKey) && hasField(elem, rel.References) {
+			return rel, nil
+		}
+	}
+
+	// HasOne or HasMany when the associated model holds the key
+	rel.Kind, rel.ForeignKey, rel.References = HasOne, foreignKey, references
+	if many {
+		rel.Kind = HasMany
+	}
+	if rel.References == "" {
+		rel.References = ownerKey
+	}
+	if rel.ForeignKey == "" && rel.References != "" {
+		rel.ForeignKey = owner.Name() + rel.References
+	}
+	if hasField(elem, rel.ForeignKey) && hasField(owner, rel.References) {
+		return rel, nil
+	}
+
+	if explicit {
+		return nil, fail("cannot find the keys of the association with %s", elem.Name())
+	}
+	return nil, fail("cannot find the keys of the association with %s by convention, "+
+		"name them with the foreign key and references tags, or tag the field orm:\"-\"", elem.Name())
+}
+
+// parseJoinTable resolves the ManyToMany association rel through joinTable.
+func (schema *Schema) parseJoinTable(owner reflect.Type, p reflect.StructField, rel *Relationship, joinTable, foreignKey, references string) error {
+	fail := func(format string, args ...interface{}) error {
+		return fmt.Errorf("schema: %s.%s: %s", owner.Name(), p.Name, fmt.Sprintf(format, args...))
+	}
+	if p.Type.Kind() != reflect.Slice {
+		return fail("many2many requires a slice")
+	}
+
+	rel.Kind, rel.JoinTable, rel.ForeignKey, rel.References = ManyToMany, joinTable, foreignKey, references
+	if rel.References == "" && len(schema.PrimaryKeys) > 0 {
+		rel.References = schema.PrimaryKeys[0].Name
+	}
+	if rel.ForeignKey == "" {
+		rel.ForeignKey = primaryKeyName(rel.Type)
+	}
+	if schema.LookUpField(rel.References) == nil || !hasField(rel.Type, rel.ForeignKey) {
+		return fail("cannot find the keys of the association with %s", rel.Type.Name())
+	}
+
+	rel.JoinForeignKey = owner.Name() + rel.References
+	rel.JoinReferences = rel.Type.Name() + rel.ForeignKey
+	if rel.JoinForeignKey == rel.JoinReferences {
+		// a model associated with itself, e.g. User.Friends
+		rel.JoinReferences = p.Name + rel.ForeignKey
+	}
+	if !ast.IsExported(rel.JoinForeignKey) || !ast.IsExported(rel.JoinReferences) {
+		return fail("join table columns %s and %s must be exported names", rel.JoinForeignKey, rel.JoinReferences)
+	}
+	return nil
+}
+
+// JoinTable returns the schema of the join table of the ManyToMany
+// association rel. Both columns form the primary key and reference the keys
+// they hold, deleting either side deletes the link.
+func (schema *Schema) JoinTable(rel *Relationship, d dialect.Dialect) (*Schema, error) {
+	if rel.Kind != ManyToMany {
+		return nil, fmt.Errorf("schema: %s.%s is not a many-to-many association", schema.Name, rel.Name)
+	}
+	elem, err := Parse(reflect.New(rel.Type).Interface(), d)
+	if err != nil {
+		return nil, err
+	}
+	ownerKey, elemKey := schema.LookUpField(rel.References), elem.LookUpField(rel.ForeignKey)
+	if ownerKey == nil || elemKey == nil {
+		return nil, fmt.Errorf("schema: %s.%s: the keys of the association are not columns", schema.Name, rel.Name)
+	}
+
+	column := func(name string, table *Schema, key *Field) reflect.StructField {
+		p, _ := reflect.Indirect(reflect.ValueOf(table.Model)).Type().FieldByName(key.Name)
+		tag := fmt.Sprintf(`orm:"primary key;references:%s.%s;on delete:cascade"`, table.Name, key.Column)
+		return reflect.StructField{Name: name, Type: p.Type, Tag: reflect.StructTag(tag)}
+	}
+	joinType := reflect.StructOf([]reflect.StructField{
+		column(rel.JoinForeignKey, schema, ownerKey),
+		column(rel.JoinReferences, elem, elemKey),
+	})
+	join, err := Parse(reflect.New(joinType).Interface(), d)
+	if err != nil {
+		return nil, err
+	}
+	join.Name = rel.JoinTable
+	return join, nil
+}
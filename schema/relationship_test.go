@@ -0,0 +1,128 @@
+package schema
+
+import (
+	"strings"
+	"testing"
+)
+
+type Owner struct {
+	ID       int `orm:"primary key"`
+	Name     string
+	Pets     []*Pet
+	Passport Passport
+	Adopted  []Pet `orm:"foreign key:AdopterID"`
+}
+
+type Pet struct {
+	ID        int `orm:"primary key"`
+	OwnerID   int
+	AdopterID int
+	Owner     *Owner
+}
+
+type Passport struct {
+	Number  string `orm:"primary key"`
+	OwnerID int
+}
+
+func TestParseRelationships(t *testing.T) {
+	schema, err := Parse(&Owner{}, TestDial)
+	if err != nil || len(schema.Fields) != 2 || len(schema.Relationships) != 3 {
+		t.Fatal("failed to parse associations", err, schema.FieldNames)
+	}
+
+	tests := []struct {
+		name       string
+		kind       RelationshipKind
+		foreignKey string
+		references string
+	}{
+		{"Pets", HasMany, "OwnerID", "ID"},
+		{"Passport", HasOne, "OwnerID", "ID"},
+		{"Adopted", HasMany, "AdopterID", "ID"},
+	}
+	for _, tt := range tests {
+		rel := schema.GetRelationship(tt.name)
+		if rel == nil || rel.Kind != tt.kind || rel.ForeignKey != tt.foreignKey || rel.References != tt.references {
+			t.Fatalf("failed to parse association %s, got %+v", tt.name, rel)
+		}
+	}
+
+	pet, err := Parse(&Pet{}, TestDial)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rel := pet.GetRelationship("Owner"); rel == nil || rel.Kind != BelongsTo || rel.ForeignKey != "OwnerID" || rel.References != "ID" {
+		t.Fatalf("failed to parse belongs to, got %+v", rel)
+	}
+}
+
+func TestParseRelationshipError(t *testing.T) {
+	_, err := Parse(&struct {
+		ID   int   `orm:"primary key"`
+		Pets []Pet `orm:"foreign key:KeeperID"`
+	}{}, TestDial)
+	if err == nil || !strings.Contains(err.Error(), "cannot find the keys") {
+		t.Fatal("expect error for an unknown foreign key, got", err)
+	}
+
+	_, err = Parse(&struct {
+		ID   int `orm:"primary key"`
+		Home Passport
+	}{}, TestDial)
+	if err == nil || !strings.Contains(err.Error(), `orm:"-"`) {
+		t.Fatal("expect error for an association without keys, got", err)
+	}
+	if _, err = Parse(&struct {
+		ID   int      `orm:"primary key"`
+		Home Passport `orm:"-"`
+	}{}, TestDial); err != nil {
+		t.Fatal("failed to ignore the field", err)
+	}
+}
+
+type Vet struct {
+	ID       int64  `orm:"primary key;auto increment"`
+	Patients []*Pet `orm:"many2many:vet_patients"`
+	Partners []Vet  `orm:"many2many:vet_partners"`
+}
+
+func TestParseManyToMany(t *testing.T) {
+	schema, err := Parse(&Vet{}, TestDial)
+	if err != nil || len(schema.Relationships) != 2 {
+		t.Fatal("failed to parse many to many", err)
+	}
+	rel := schema.GetRelationship("Patients")
+	if rel.Kind != ManyToMany || rel.JoinTable != "vet_patients" || rel.JoinForeignKey != "VetID" || rel.JoinReferences != "PetID" {
+		t.Fatalf("failed to parse many to many, got %+v", rel)
+	}
+	if rel := schema.GetRelationship("Partners"); rel.JoinForeignKey != "VetID" || rel.JoinReferences != "PartnersID" {
+		t.Fatalf("failed to name the columns of a self join, got %+v", rel)
+	}
+
+	join, err := schema.JoinTable(rel, TestDial)
+	if err != nil || join.Name != "vet_patients" || len(join.PrimaryKeys) != 2 {
+		t.Fatal("failed to build the join table", err)
+	}
+	want := []string{
+		`"VetID" bigint`,
+		`"PetID" integer`,
+		`PRIMARY KEY ("VetID", "PetID")`,
+		`FOREIGN KEY ("VetID") REFERENCES "Vet" ("ID") ON DELETE CASCADE`,
+		`FOREIGN KEY ("PetID") REFERENCES "Pet" ("ID") ON DELETE CASCADE`,
+	}
+	if got := join.ColumnDefinitions(); strings.Join(got, ", ") != strings.Join(want, ", ") {
+		t.Fatal("unexpected join table definition", got)
+	}
+
+	if _, err := schema.JoinTable(&Relationship{Name: "Pets", Kind: HasMany}, TestDial); err == nil {
+		t.Fatal("expect error building the join table of a has many")
+	}
+	_, err = Parse(&struct {
+		ID  int `orm:"primary key"`
+		Pet Pet `orm:"many2many:owner_pets"`
+	}{}, TestDial)
+	if err == nil || !strings.Contains(err.Error(), "requires a slice") {
+		t.Fatal("expect error for a many to many struct field, got", err)
+	}
+}
@@ -1,49 +1,197 @@
 package schema
 
 import (
+	"fmt"
 	"go/ast"
 	"reflect"
+	"strings"
 
 	"orm/dialect"
 )
 
 type Field struct {
-	Name string
-	Type string
-	Tag  string
+	Name   string // name of the struct field
+	Column string // name of the table column
+	Type   string
+
+	PrimaryKey    bool
+	AutoIncrement bool
+	NotNull       bool
+	Unique        bool
+	HasDefault    bool
+	Default       string
+	Size          int
+
+	autoIncrement string // dialect keyword declaring AutoIncrement
+	quoted        string // Column quoted by the dialect
+	indexes       []fieldIndex
+	references    *ForeignKey
+	softDelete    bool
+	createTime    bool
+	updateTime    bool
+}
+
+// Definition returns the column definition used by CREATE TABLE and
+// ALTER TABLE ADD COLUMN, e.g. "Age integer NOT NULL DEFAULT 18".
+func (f *Field) Definition() string {
+	return f.definition(true)
+}
+
+func (f *Field) definition(inlineKey bool) string {
+	parts := []string{f.quoted, f.Type}
+	if f.PrimaryKey && inlineKey {
+		parts = append(parts, "PRIMARY KEY")
+	}
+	if f.AutoIncrement && f.autoIncrement != "" {
+		parts = append(parts, f.autoIncrement)
+	}
+	if f.NotNull {
+		parts = append(parts, "NOT NULL")
+	}
+	if f.Unique {
+		parts = append(parts, "UNIQUE")
+	}
+	if f.HasDefault {
+		parts = append(parts, "DEFAULT", f.Default)
+	}
+	return strings.Join(parts, " ")
 }
 
 type Schema struct {
-	Model      interface{}
-	Name       string
-	Fields     []*Field
-	FieldNames []string
-	fieldMap   map[string]*Field
+	Model       interface{}
+	Name        string
+	Fields      []*Field
+	FieldNames  []string // column names, in field order
+	PrimaryKeys []*Field
+	Indexes     []*Index
+	ForeignKeys []*ForeignKey
+	// Relationships are the association fields, which are not columns
+	Relationships []*Relationship
+	// DeletedAt is the soft delete field, a nullable time named DeletedAt or
+	// tagged soft delete, or nil. Deleting sets it instead of removing the
+	// row, and queries leave out the rows where it is set.
+	DeletedAt *Field
+	// CreatedAt and UpdatedAt are the timestamp fields, named so or tagged
+	// auto create time and auto update time, or nil. Insert sets both when
+	// unset and Update sets UpdatedAt.
+	CreatedAt *Field
+	UpdatedAt *Field
+	fieldMap  map[string]*Field
 }
 
 type ITable interface {
 	TableName() string
 }
 
+// GetField returns the field mapped to the column name.
 func (schema *Schema) GetField(name string) *Field {
 	return schema.fieldMap[name]
 }
 
+// ColumnDefinitions returns the column definitions of CREATE TABLE, followed
+// by a table constraint when the primary key spans several columns and by the
+// foreign keys.
+func (schema *Schema) ColumnDefinitions() []string {
+	composite := len(schema.PrimaryKeys) > 1
+	var defs []string
+	for _, field := range schema.Fields {
+		defs = append(defs, field.definition(!composite))
+	}
+	if composite {
+		var keys []string
+		for _, field := range schema.PrimaryKeys {
+			keys = append(keys, field.quoted)
+		}
+		defs = append(defs, fmt.Sprintf("PRIMARY KEY (%s)", strings.Join(keys, ", ")))
+	}
+	for _, fk := range schema.ForeignKeys {
+		defs = append(defs, fk.definition)
+	}
+	return defs
+}
+
+// AutoIncrementField returns the auto increment primary key, or nil.
+func (schema *Schema) AutoIncrementField() *Field {
+	for _, field := range schema.PrimaryKeys {
+		if field.AutoIncrement {
+			return field
+		}
+	}
+	return nil
+}
+
+// PrimaryKeyCondition returns the WHERE expression matching one record by
+// primary key, e.g. "ID = ?", to be used with PrimaryKeyValues.
+func (schema *Schema) PrimaryKeyCondition() string {
+	var conds []string
+	for _, field := range schema.PrimaryKeys {
+		conds = append(conds, field.quoted+" = ?")
+	}
+	return strings.Join(conds, " AND ")
+}
+
+func (schema *Schema) PrimaryKeyValues(dest interface{}) []interface{} {
+	return schema.FieldValues(dest, schema.PrimaryKeys)
+}
+
+// IsPrimaryKeyZero reports whether every primary key of dest is unset.
+func (schema *Schema) IsPrimaryKeyZero(dest interface{}) bool {
+	destValue := reflect.Indirect(reflect.ValueOf(dest))
+	for _, field := range schema.PrimaryKeys {
+		if !destValue.FieldByName(field.Name).IsZero() {
+			return false
+		}
+	}
+	return true
+}
+
+// InsertFields returns the fields written by INSERT. The auto increment key is
+// left to the database when none of the records sets it.
+func (schema *Schema) InsertFields(dests ...interface{}) []*Field {
+	auto := schema.AutoIncrementField()
+	if auto == nil {
+		return schema.Fields
+	}
+	for _, dest := range dests {
+		if !reflect.Indirect(reflect.ValueOf(dest)).FieldByName(auto.Name).IsZero() {
+			return schema.Fields
+		}
+	}
+
+	fields := make([]*Field, 0, len(schema.Fields)-1)
+	for _, field := range schema.Fields {
+		if field != auto {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
 func (schema *Schema) RecordValues(dest interface{}) []interface{} {
+	return schema.FieldValues(dest, schema.Fields)
+}
+
+func (schema *Schema) FieldValues(dest interface{}, fields []*Field) []interface{} {
 	destValue := reflect.Indirect(reflect.ValueOf(dest))
 	var fieldValues []interface{}
-	for _, field := range schema.Fields {
+	for _, field := range fields {
 		fieldValues = append(fieldValues, destValue.FieldByName(field.Name).Interface())
 	}
 	return fieldValues
 }
 
-func Parse(dest interface{}, d dialect.Dialect) *Schema {
+func Parse(dest interface{}, d dialect.Dialect) (*Schema, error) {
 	modelType := reflect.Indirect(reflect.ValueOf(dest)).Type()
+	if modelType.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("schema: model %s is not a struct", modelType)
+	}
 
+	// TableName is usually declared on the pointer receiver
 	var tableName string
 	if t, ok := dest.(ITable); ok {
 		tableName = t.TableName()
+	} else if t, ok := reflect.New(modelType).Interface().(ITable); ok {
+		tableName = t.TableName()
 	} else {
 		tableName = modelType.Name()
 	}
@@ -54,20 +202,87 @@ func Parse(dest interface{}, d dialect.Dialect) *Schema {
 		fieldMap: make(map[string]*Field),
 	}
 
+	var associations []reflect.StructField
 	for i := 0; i < modelType.NumField(); i++ {
 		p := modelType.Field(i)
-		if !p.Anonymous && ast.IsExported(p.Name) {
-			field := &Field{
-				Name: p.Name,
-				Type: d.DataTypeOf(reflect.Indirect(reflect.New(p.Type))),
+		if p.Anonymous || !ast.IsExported(p.Name) {
+			continue
+		}
+
+		tag, hasTag := p.Tag.Lookup("orm")
+		if strings.TrimSpace(tag) == tagIgnore {
+			continue
+		}
+		if elem, _ := associationType(p.Type); elem != nil {
+			// resolved once the primary keys are known
+			associations = append(associations, p)
+			continue
+		}
+
+		field := &Field{
+			Name:   p.Name,
+			Column: p.Name,
+		}
+		if hasTag {
+			if err := parseTag(field, p, modelType.Name(), tag); err != nil {
+				return nil, err
 			}
-			if v, ok := p.Tag.Lookup("orm"); ok {
-				field.Tag = v
+		}
+		if _, ok := schema.fieldMap[field.Column]; ok {
+			return nil, fmt.Errorf("schema: %s.%s: duplicate column %q", modelType.Name(), p.Name, field.Column)
+		}
+		field.quoted = d.Quote(field.Column)
+		field.Type = d.DataTypeOf(reflect.Indirect(reflect.New(p.Type)), field.Size)
+		if field.Type == "" {
+			return nil, fmt.Errorf("schema: %s.%s: no column type for %s, tag the field orm:\"-\"", modelType.Name(), p.Name, p.Type)
+		}
+		if field.AutoIncrement {
+			field.Type, field.autoIncrement = d.AutoIncrement(field.Type)
+		}
+
+		schema.Fields = append(schema.Fields, field)
+		schema.FieldNames = append(schema.FieldNames, field.Column)
+		schema.fieldMap[field.Column] = field
+		if field.PrimaryKey {
+			schema.PrimaryKeys = append(schema.PrimaryKeys, field)
+		}
+		if fk := field.references; fk != nil {
+			fk.definition = fk.define(d)
+			schema.ForeignKeys = append(schema.ForeignKeys, fk)
+		}
+		if field.softDelete || (p.Name == "DeletedAt" && isNullableTime(p.Type)) {
+			if schema.DeletedAt != nil {
+				return nil, fmt.Errorf("schema: %s.%s: %s is the soft delete field already", modelType.Name(), p.Name, schema.DeletedAt.Name)
 			}
-			schema.Fields = append(schema.Fields, field)
-			schema.FieldNames = append(schema.FieldNames, p.Name)
-			schema.fieldMap[p.Name] = field
+			schema.DeletedAt = field
+		}
+		if field.createTime || (p.Name == "CreatedAt" && isTime(p.Type)) {
+			if schema.CreatedAt != nil {
+				return nil, fmt.Errorf("schema: %s.%s: %s is the create time field already", modelType.Name(), p.Name, schema.CreatedAt.Name)
+			}
+			schema.CreatedAt = field
+		}
+		if field.updateTime || (p.Name == "UpdatedAt" && isTime(p.Type)) {
+			if schema.UpdatedAt != nil {
+				return nil, fmt.Errorf("schema: %s.%s: %s is the update time field already", modelType.Name(), p.Name, schema.UpdatedAt.Name)
+			}
+			schema.UpdatedAt = field
+		}
+	}
+
+	if len(schema.PrimaryKeys) > 1 && schema.AutoIncrementField() != nil {
+		return nil, fmt.Errorf("schema: %s: auto increment is not allowed in a composite primary key", modelType.Name())
+	}
+	if err := schema.parseIndexes(modelType, d); err != nil {
+		return nil, err
+	}
+	for _, p := range associations {
+		elem, many := associationType(p.Type)
+		rel, err := schema.parseRelationship(modelType, p, elem, many)
+		if err != nil {
+			return nil, err
 		}
+		schema.Relationships = append(schema.Relationships, rel)
 	}
-	return schema
+	return schema, nil
 }
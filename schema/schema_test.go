@@ -1,7 +1,10 @@
 package schema
 
 import (
+	"database/sql"
+	"strings"
 	"testing"
+	"time"
 
 	"orm/dialect"
 )
@@ -18,11 +21,189 @@ func (u *User) TableName() string {
 var TestDial, _ = dialect.GetDialect("sqlite3")
 
 func TestParse(t *testing.T) {
-	schema := Parse(&User{}, TestDial)
-	if schema.Name != "users" || len(schema.Fields) != 2 {
-		t.Fatal("failed to parse User struct")
+	schema, err := Parse(&User{}, TestDial)
+	if err != nil || schema.Name != "users" || len(schema.Fields) != 2 {
+		t.Fatal("failed to parse User struct", err)
 	}
-	if schema.GetField("Name").Tag != "PRIMARY KEY" {
+	if !schema.GetField("Name").PrimaryKey {
 		t.Fatal("failed to pase primary key")
 	}
 }
+
+type Product struct {
+	ID       int    `orm:"primary key;auto increment"`
+	Title    string `orm:"column:title;not null;unique;size:64"`
+	Price    int    `orm:"default:0"`
+	Internal string `orm:"-"`
+}
+
+func TestParseTag(t *testing.T) {
+	schema, err := Parse(&Product{}, TestDial)
+	if err != nil {
+		t.Fatal("failed to parse Product struct", err)
+	}
+	if len(schema.Fields) != 3 || schema.GetField("Internal") != nil {
+		t.Fatal("failed to ignore field, got", schema.FieldNames)
+	}
+
+	title := schema.GetField("title")
+	if title == nil || title.Name != "Title" || !title.NotNull || !title.Unique || title.Size != 64 {
+		t.Fatal("failed to parse column options", title)
+	}
+
+	want := []string{
+		`"ID" integer PRIMARY KEY AUTOINCREMENT`,
+		`"title" text NOT NULL UNIQUE`,
+		`"Price" integer DEFAULT 0`,
+	}
+	for i, field := range schema.Fields {
+		if got := field.Definition(); got != want[i] {
+			t.Fatalf("expect definition %q, got %q", want[i], got)
+		}
+	}
+}
+
+func TestParseTagError(t *testing.T) {
+	tests := []struct {
+		name  string
+		model interface{}
+		err   string
+	}{
+		{"unknown option", &struct {
+			Name string `orm:"primay key"`
+		}{}, `unknown tag option "primay key"`},
+		{"missing value", &struct {
+			Name string `orm:"column:"`
+		}{}, `requires a value`},
+		{"unexpected value", &struct {
+			Name string `orm:"unique:yes"`
+		}{}, `does not take a value`},
+		{"invalid size", &struct {
+			Name string `orm:"size:-1"`
+		}{}, `size must be a positive integer`},
+		{"auto increment on string", &struct {
+			Name string `orm:"primary key;auto increment"`
+		}{}, `requires an integer field`},
+		{"auto increment without primary key", &struct {
+			ID int `orm:"auto increment"`
+		}{}, `only allowed on a primary key`},
+		{"invalid references", &struct {
+			UserID int `orm:"references:users"`
+		}{}, `references must be table.column`},
+		{"unknown action", &struct {
+			UserID int `orm:"references:users.ID;on delete:explode"`
+		}{}, `unknown referential action "explode"`},
+		{"action without references", &struct {
+			UserID int `orm:"on update:cascade"`
+		}{}, `require references`},
+		{"duplicate column", &struct {
+			Name  string
+			Alias string `orm:"column:Name"`
+		}{}, `duplicate column "Name"`},
+		{"soft delete on time", &struct {
+			Removed time.Time `orm:"soft delete"`
+		}{}, `soft delete requires a *time.Time or sql.NullTime field`},
+		{"two soft delete fields", &struct {
+			DeletedAt *time.Time
+			Removed   sql.NullTime `orm:"soft delete"`
+		}{}, `DeletedAt is the soft delete field already`},
+		{"create time on string", &struct {
+			Created string `orm:"auto create time"`
+		}{}, `auto create time requires a time.Time`},
+		{"map field", &struct {
+			Tags map[string]string
+		}{}, `no column type for map[string]string`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(tt.model, TestDial)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("expect error containing %q, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestParseNullTypes(t *testing.T) {
+	schema, err := Parse(&struct {
+		ID   int `orm:"primary key"`
+		Note sql.NullString
+		Rank sql.NullInt64
+	}{}, TestDial)
+	if err != nil || schema.GetField("Note").Type != "text" || schema.GetField("Rank").Type != "bigint" {
+		t.Fatal("failed to parse sql.Null fields", err)
+	}
+}
+
+type Membership struct {
+	GroupID int `orm:"primary key"`
+	UserID  int `orm:"primary key"`
+	Role    string
+}
+
+func TestParsePrimaryKeys(t *testing.T) {
+	schema, _ := Parse(&Membership{}, TestDial)
+	if len(schema.PrimaryKeys) != 2 || schema.PrimaryKeyCondition() != `"GroupID" = ? AND "UserID" = ?` {
+		t.Fatal("failed to parse composite primary key")
+	}
+
+	defs := schema.ColumnDefinitions()
+	if defs[0] != `"GroupID" integer` || defs[3] != `PRIMARY KEY ("GroupID", "UserID")` {
+		t.Fatal("failed to define composite primary key, got", defs)
+	}
+
+	m := &Membership{GroupID: 1, UserID: 2}
+	if schema.IsPrimaryKeyZero(m) || !schema.IsPrimaryKeyZero(&Membership{}) {
+		t.Fatal("failed to check primary key values")
+	}
+	if values := schema.PrimaryKeyValues(m); values[0] != 1 || values[1] != 2 {
+		t.Fatal("failed to get primary key values, got", values)
+	}
+}
+
+func TestParseSoftDelete(t *testing.T) {
+	schema, err := Parse(&struct {
+		ID        int `orm:"primary key"`
+		DeletedAt *time.Time
+	}{}, TestDial)
+	if err != nil || schema.DeletedAt == nil || schema.DeletedAt.Definition() != `"DeletedAt" datetime` {
+		t.Fatal("failed to detect the DeletedAt field", err)
+	}
+
+	schema, err = Parse(&struct {
+		ID      int          `orm:"primary key"`
+		Removed sql.NullTime `orm:"column:removed_at;soft delete"`
+	}{}, TestDial)
+	if err != nil || schema.DeletedAt == nil || schema.DeletedAt.Column != "removed_at" {
+		t.Fatal("failed to parse the soft delete tag", err)
+	}
+
+	// a DeletedAt which cannot be NULL is a plain column
+	schema, _ = Parse(&struct {
+		DeletedAt time.Time
+	}{}, TestDial)
+	if schema.DeletedAt != nil {
+		t.Fatal("expect a time.Time DeletedAt not to soft delete")
+	}
+}
+
+func TestParseTimestamps(t *testing.T) {
+	schema, err := Parse(&struct {
+		ID        int `orm:"primary key"`
+		CreatedAt time.Time
+		UpdatedAt *time.Time
+	}{}, TestDial)
+	if err != nil || schema.CreatedAt == nil || schema.UpdatedAt == nil || schema.UpdatedAt.Name != "UpdatedAt" {
+		t.Fatal("failed to detect the timestamp fields", err)
+	}
+
+	schema, err = Parse(&struct {
+		Inserted sql.NullTime `orm:"column:inserted_at;auto create time"`
+		Changed  time.Time    `orm:"auto_update_time"`
+		Checked  time.Time
+	}{}, TestDial)
+	if err != nil || schema.CreatedAt.Column != "inserted_at" || schema.UpdatedAt.Name != "Changed" {
+		t.Fatal("failed to parse the timestamp tags", err)
+	}
+}
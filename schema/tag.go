@@ -0,0 +1,194 @@
+package schema
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// tag options understood inside `orm:"..."`, separated by ';'
+//
+//	orm:"-"
+//	orm:"primary key;auto increment"
+//	orm:"column:user_name;not null;unique;size:64;default:''"
+//	orm:"index;unique index:idx_tenant_email"
+//	orm:"references:users.ID;on delete:cascade;on update:restrict"
+//	orm:"many2many:user_roles"
+//	orm:"column:deleted_at;soft delete"
+//	orm:"column:inserted_at;auto create time"
+const (
+	tagIgnore        = "-"
+	tagPrimaryKey    = "PRIMARY KEY"
+	tagColumn        = "COLUMN"
+	tagNotNull       = "NOT NULL"
+	tagUnique        = "UNIQUE"
+	tagDefault       = "DEFAULT"
+	tagSize          = "SIZE"
+	tagAutoIncrement = "AUTO INCREMENT"
+	tagIndex         = "INDEX"
+	tagUniqueIndex   = "UNIQUE INDEX"
+	tagReferences    = "REFERENCES"
+	tagOnDelete      = "ON DELETE"
+	tagOnUpdate      = "ON UPDATE"
+	tagSoftDelete    = "SOFT DELETE"
+	tagCreateTime    = "AUTO CREATE TIME"
+	tagUpdateTime    = "AUTO UPDATE TIME"
+	// options of association fields
+	tagForeignKey = "FOREIGN KEY"
+	tagMany2Many  = "MANY2MANY"
+)
+
+// normalizeTagKey makes "primary_key", "Primary Key" and "PRIMARY  KEY" equal,
+// and accepts the single-word spellings used by the SQL keywords.
+func normalizeTagKey(key string) string {
+	key = strings.ToUpper(strings.ReplaceAll(key, "_", " "))
+	key = strings.Join(strings.Fields(key), " ")
+	switch key {
+	case "PRIMARYKEY":
+		return tagPrimaryKey
+	case "NOTNULL":
+		return tagNotNull
+	case "AUTOINCREMENT":
+		return tagAutoIncrement
+	case "UNIQUEINDEX":
+		return tagUniqueIndex
+	case "ONDELETE":
+		return tagOnDelete
+	case "ONUPDATE":
+		return tagOnUpdate
+	case "SOFTDELETE":
+		return tagSoftDelete
+	case "AUTOCREATETIME":
+		return tagCreateTime
+	case "AUTOUPDATETIME":
+		return tagUpdateTime
+	case "FOREIGNKEY":
+		return tagForeignKey
+	case "MANY 2 MANY", "MANY TO MANY", "MANYTOMANY":
+		return tagMany2Many
+	}
+	return key
+}
+
+func isIntegerKind(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+	return false
+}
+
+// parseTag applies the options of an orm tag to field. p is the struct field
+// the tag belongs to, model is only used to make error messages readable.
+func parseTag(field *Field, p reflect.StructField, model string, tag string) error {
+	fail := func(format string, args ...interface{}) error {
+		return fmt.Errorf("schema: %s.%s: %s", model, p.Name, fmt.Sprintf(format, args...))
+	}
+
+	var onDelete, onUpdate string
+	for _, option := range strings.Split(tag, ";") {
+		option = strings.TrimSpace(option)
+		if option == "" {
+			continue
+		}
+
+		key, value, hasValue := strings.Cut(option, ":")
+		key = normalizeTagKey(key)
+		value = strings.TrimSpace(value)
+
+		switch key {
+		case tagColumn, tagDefault, tagSize, tagReferences, tagOnDelete, tagOnUpdate:
+			if !hasValue || value == "" {
+				return fail("tag option %q requires a value", option)
+			}
+		case tagIndex, tagUniqueIndex:
+			// the index name is optional
+			if hasValue && value == "" {
+				return fail("tag option %q requires a value", option)
+			}
+		default:
+			if hasValue {
+				return fail("tag option %q does not take a value", option)
+			}
+		}
+
+		switch key {
+		case tagPrimaryKey:
+			field.PrimaryKey = true
+		case tagColumn:
+			if strings.ContainsAny(value, " \t\"'`;,()") {
+				return fail("invalid column name %q", value)
+			}
+			field.Column = value
+		case tagNotNull:
+			field.NotNull = true
+		case tagUnique:
+			field.Unique = true
+		case tagDefault:
+			field.Default = value
+			field.HasDefault = true
+		case tagSize:
+			size, err := strconv.Atoi(value)
+			if err != nil || size <= 0 {
+				return fail("size must be a positive integer, got %q", value)
+			}
+			field.Size = size
+		case tagAutoIncrement:
+			if !isIntegerKind(p.Type.Kind()) {
+				return fail("auto increment requires an integer field, got %s", p.Type)
+			}
+			field.AutoIncrement = true
+		case tagIndex, tagUniqueIndex:
+			if strings.ContainsAny(value, " \t\"'`;,()") {
+				return fail("invalid index name %q", value)
+			}
+			field.indexes = append(field.indexes, fieldIndex{name: value, unique: key == tagUniqueIndex})
+		case tagReferences:
+			table, column, ok := strings.Cut(value, ".")
+			if !ok || table == "" || column == "" || strings.ContainsAny(value, " \t\"'`;,()") {
+				return fail("references must be table.column, got %q", value)
+			}
+			field.references = &ForeignKey{Column: field.Column, RefTable: table, RefColumn: column}
+		case tagSoftDelete:
+			if !isNullableTime(p.Type) {
+				return fail("soft delete requires a *time.Time or sql.NullTime field, got %s", p.Type)
+			}
+			field.softDelete = true
+		case tagCreateTime, tagUpdateTime:
+			if !isTime(p.Type) {
+				return fail("%s requires a time.Time, *time.Time or sql.NullTime field, got %s", strings.ToLower(key), p.Type)
+			}
+			if key == tagCreateTime {
+				field.createTime = true
+			} else {
+				field.updateTime = true
+			}
+		case tagOnDelete, tagOnUpdate:
+			action, ok := referentialAction(value)
+			if !ok {
+				return fail("unknown referential action %q", value)
+			}
+			if key == tagOnDelete {
+				onDelete = action
+			} else {
+				onUpdate = action
+			}
+		default:
+			return fail("unknown tag option %q", option)
+		}
+	}
+
+	if field.AutoIncrement && !field.PrimaryKey {
+		return fail("auto increment is only allowed on a primary key")
+	}
+	if field.references != nil {
+		// the column tag may follow references
+		field.references.Column = field.Column
+		field.references.OnDelete, field.references.OnUpdate = onDelete, onUpdate
+	} else if onDelete != "" || onUpdate != "" {
+		return fail("on delete and on update require references")
+	}
+	return nil
+}
@@ -0,0 +1,332 @@
+package session
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"orm/clause"
+	"orm/schema"
+)
+
+// Preload makes Find and First load the association fields named, with one
+// more query per association, e.g. s.Preload("Orders").Find(&users) loads the
+// orders of all the users with a single UserID IN (...) query. Nested
+// associations are separated by dots, "Orders.Items".
+func (s *Session) Preload(associations ...string) *Session {
+	s.preloads = append(s.preloads, associations...)
+	return s
+}
+
+// sub returns a session for the extra statements of an operation, in the
+// same transaction and context. Its savepoints are named after those of s,
+// so they do not reuse the name of one still open.
+func (s *Session) sub() *Session {
+	sub := New(s.db, s.dialect).WithCallbacks(s.callbacks).WithClock(s.clock).WithContext(s.ctx)
+	sub.tx, sub.outerSavepoints = s.tx, s.outerSavepoints+len(s.savepoints)
+	return sub
+}
+
+// keyOf returns the key held by v for use in a map, integers of any size are
+// equal and pointers are followed, nil is a NULL key.
+func keyOf(v reflect.Value) interface{} {
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(v.Uint())
+	}
+	return v.Interface()
+}
+
+// ownerKeys returns the distinct keys held by the field name of records,
+// NULL keys left out.
+func ownerKeys(records reflect.Value, name string) []interface{} {
+	var keys []interface{}
+	seen := make(map[interface{}]bool)
+	for i := 0; i < records.Len(); i++ {
+		if key := keyOf(records.Index(i).FieldByName(name)); key != nil && !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// preload loads the associations into records, a slice of models of table.
+func (s *Session) preload(table *schema.Schema, records reflect.Value, preloads []string) error {
+	// "Orders.Items" preloads Items into the orders
+	var names []string
+	nested := make(map[string][]string)
+	for _, preload := range preloads {
+		name, rest, _ := strings.Cut(preload, ".")
+		if _, ok := nested[name]; !ok {
+			names = append(names, name)
+			nested[name] = nil
+		}
+		if rest != "" {
+			nested[name] = append(nested[name], rest)
+		}
+	}
+
+	for _, name := range names {
+		rel := table.GetRelationship(name)
+		if rel == nil {
+			return fmt.Errorf("model %s has no association %s", table.Name, name)
+		}
+		var err error
+		if rel.Kind == schema.ManyToMany {
+			err = s.preloadJoinTable(table, rel, records, nested[name])
+		} else {
+			err = s.preloadRelationship(rel, records, nested[name])
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Session) preloadRelationship(rel *schema.Relationship, records reflect.Value, nested []string) error {
+	// ownerKey holds the key in the records, relatedKey in the associated models
+	ownerKey, relatedKey := rel.References, rel.ForeignKey
+	if rel.Kind == schema.BelongsTo {
+		ownerKey, relatedKey = rel.ForeignKey, rel.References
+	}
+
+	keys := ownerKeys(records, ownerKey)
+	related := reflect.New(reflect.SliceOf(rel.Type))
+	if len(keys) > 0 {
+		sub := s.sub()
+		relTable := sub.Model(reflect.New(rel.Type).Interface()).RefTable()
+		if relTable == nil {
+			return sub.ModelError()
+		}
+		field := relTable.LookUpField(relatedKey)
+		if field == nil {
+			return fmt.Errorf("association %s: %s.%s is not a column", rel.Name, rel.Type.Name(), relatedKey)
+		}
+		err := sub.Preload(nested...).Where(clause.In(s.dialect.Quote(field.Column), keys...)).Find(related.Interface())
+		if err != nil {
+			return err
+		}
+	}
+
+	matches := make(map[interface{}][]reflect.Value)
+	results := related.Elem()
+	for i := 0; i < results.Len(); i++ {
+		result := results.Index(i)
+		key := keyOf(result.FieldByName(relatedKey))
+		matches[key] = append(matches[key], result)
+	}
+
+	for i := 0; i < records.Len(); i++ {
+		record := records.Index(i)
+		found := matches[keyOf(record.FieldByName(ownerKey))]
+		field := record.FieldByName(rel.Name)
+		if rel.Kind == schema.HasMany {
+			slice := reflect.MakeSlice(field.Type(), 0, len(found))
+			for _, result := range found {
+				slice = reflect.Append(slice, as(result, field.Type().Elem()))
+			}
+			field.Set(slice)
+		} else if len(found) > 0 {
+			field.Set(as(found[0], field.Type()))
+		}
+	}
+	return nil
+}
+
+// as returns the addressable model v as typ, the struct or a pointer to it.
+func as(v reflect.Value, typ reflect.Type) reflect.Value {
+	if typ.Kind() == reflect.Ptr {
+		return v.Addr()
+	}
+	return v
+}
+
+// OmitAssociations makes the next Insert write the records alone, leaving
+// the associated models set in them out.
+func (s *Session) OmitAssociations() *Session {
+	s.omitAssociations = true
+	return s
+}
+
+// associated returns the associated models held by the field of rel in
+// record, addressable so generated keys can be set into them.
+func associated(record reflect.Value, rel *schema.Relationship) []reflect.Value {
+	var models []reflect.Value
+	add := func(v reflect.Value) {
+		if v = reflect.Indirect(v); v.IsValid() && !v.IsZero() {
+			models = append(models, v)
+		}
+	}
+	field := record.FieldByName(rel.Name)
+	if field.Kind() == reflect.Slice {
+		for i := 0; i < field.Len(); i++ {
+			add(field.Index(i))
+		}
+	} else {
+		add(field)
+	}
+	return models
+}
+
+// recordsOf returns the addressable records of value, a model or a slice.
+func recordsOf(value reflect.Value) []reflect.Value {
+	if value.Kind() == reflect.Struct {
+		if !value.CanAddr() {
+			record := reflect.New(value.Type()).Elem()
+			record.Set(value)
+			value = record
+		}
+		return []reflect.Value{value}
+	}
+	var records []reflect.Value
+	for i := 0; i < value.Len(); i++ {
+		records = append(records, reflect.Indirect(value.Index(i)))
+	}
+	return records
+}
+
+func hasAssociations(table *schema.Schema, value reflect.Value) bool {
+	if len(table.Relationships) == 0 {
+		return false
+	}
+	for _, record := range recordsOf(value) {
+		if !record.IsValid() {
+			continue
+		}
+		for _, rel := range table.Relationships {
+			if len(associated(record, rel)) > 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// insertAssociated inserts the records of value with their associated models.
+func (s *Session) insertAssociated(table *schema.Schema, value reflect.Value) (int64, error) {
+	var total int64
+	for _, record := range recordsOf(value) {
+		if !record.IsValid() {
+			return 0, fmt.Errorf("cannot insert a nil %s", table.Name)
+		}
+		// the models the record belongs to hold the keys it refers to
+		for _, rel := range table.Relationships {
+			if rel.Kind != schema.BelongsTo {
+				continue
+			}
+			for _, parent := range associated(record, rel) {
+				if err := s.insertMissing(parent); err != nil {
+					return 0, err
+				}
+				if err := setKey(record.FieldByName(rel.ForeignKey), parent.FieldByName(rel.References)); err != nil {
+					return 0, fmt.Errorf("association %s: %w", rel.Name, err)
+				}
+			}
+		}
+
+		n, err := s.sub().OmitAssociations().Insert(record.Addr().Interface())
+		if err != nil {
+			return 0, err
+		}
+		total += n
+
+		for _, rel := range table.Relationships {
+			models := associated(record, rel)
+			if len(models) == 0 {
+				continue
+			}
+			switch rel.Kind {
+			case schema.HasOne, schema.HasMany:
+				for _, child := range models {
+					if err := setKey(child.FieldByName(rel.ForeignKey), record.FieldByName(rel.References)); err != nil {
+						return 0, fmt.Errorf("association %s: %w", rel.Name, err)
+					}
+					if err := s.insertOrAdopt(child, rel.ForeignKey); err != nil {
+						return 0, err
+					}
+				}
+			case schema.ManyToMany:
+				join, err := table.JoinTable(rel, s.dialect)
+				if err != nil {
+					return 0, err
+				}
+				a := &Association{s: s, rel: rel, join: join, record: record, key: record.FieldByName(rel.References).Interface()}
+				if err := a.link(s, models); err != nil {
+					return 0, err
+				}
+			}
+		}
+	}
+	return total, nil
+}
+
+// saved reports whether the primary key of the model is set and a row with
+// that key exists.
+func (s *Session) saved(model reflect.Value) (*schema.Schema, bool, error) {
+	value := model.Addr().Interface()
+	sub := s.sub()
+	table, err := sub.primaryKeyTable(value)
+	if err != nil || table.IsPrimaryKeyZero(value) {
+		return table, false, err
+	}
+	// a soft deleted row holds the key as well
+	n, err := sub.Unscoped().Where(table.PrimaryKeyCondition(), table.PrimaryKeyValues(value)...).Count()
+	return table, n > 0, err
+}
+
+// insertMissing inserts the associated model unless it is saved already.
+func (s *Session) insertMissing(model reflect.Value) error {
+	_, saved, err := s.saved(model)
+	if err != nil || saved {
+		return err
+	}
+	_, err = s.sub().Insert(model.Addr().Interface())
+	return err
+}
+
+// insertOrAdopt inserts the child model, or when it is saved already, only
+// updates its foreign key field to the key it holds.
+func (s *Session) insertOrAdopt(child reflect.Value, foreignKey string) error {
+	value := child.Addr().Interface()
+	table, saved, err := s.saved(child)
+	if err != nil {
+		return err
+	}
+	if !saved {
+		_, err = s.sub().Insert(value)
+		return err
+	}
+	column := table.LookUpField(foreignKey).Column
+	_, err = s.sub().Model(value).Unscoped().Where(table.PrimaryKeyCondition(), table.PrimaryKeyValues(value)...).
+		Update(column, child.FieldByName(foreignKey).Interface())
+	return err
+}
+
+// setKey copies the key src into the field dst, integers of any size are
+// assignable to each other.
+func setKey(dst, src reflect.Value) error {
+	if src.Type() != dst.Type() && !(isInteger(src.Kind()) && isInteger(dst.Kind())) {
+		return fmt.Errorf("cannot copy a key of type %s into %s", src.Type(), dst.Type())
+	}
+	dst.Set(src.Convert(dst.Type()))
+	return nil
+}
+
+func isInteger(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,241 @@
+package session
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type Shopper struct {
+	ID      int `orm:"primary key"`
+	Name    string
+	Baskets []Basket
+	Card    *Card
+}
+
+type Basket struct {
+	ID        int `orm:"primary key"`
+	ShopperID int
+	Total     float64
+	Shopper   *Shopper
+	Items     []*Item
+}
+
+type Card struct {
+	ID        int `orm:"primary key"`
+	ShopperID int64
+	Number    string
+}
+
+type Item struct {
+	ID       int `orm:"primary key"`
+	BasketID int
+	Name     string
+}
+
+func testAssociationInit(t *testing.T) *Session {
+	t.Helper()
+	s := NewSession()
+	for _, records := range []interface{}{
+		[]*Shopper{{ID: 1, Name: "Tom"}, {ID: 2, Name: "Sam"}, {ID: 3, Name: "Lily"}},
+		[]*Basket{{ID: 1, ShopperID: 1, Total: 10}, {ID: 2, ShopperID: 1, Total: 20}, {ID: 3, ShopperID: 2, Total: 30}},
+		[]*Card{{ID: 1, ShopperID: 2, Number: "4242"}},
+		[]*Item{{ID: 1, BasketID: 1, Name: "Pen"}, {ID: 2, BasketID: 1, Name: "Ink"}, {ID: 3, BasketID: 3, Name: "Book"}},
+	} {
+		model := reflect.ValueOf(records).Index(0).Interface()
+		err1 := s.Model(model).DropTable()
+		err2 := s.CreateTable()
+		_, err3 := s.Insert(records)
+		if err1 != nil || err2 != nil || err3 != nil {
+			t.Fatal("failed init association records", err1, err2, err3)
+		}
+	}
+	return s
+}
+
+func TestSession_PreloadHasMany(t *testing.T) {
+	s := testAssociationInit(t)
+
+	var shoppers []Shopper
+	if err := s.Preload("Baskets", "Card").OrderBy("ID").Find(&shoppers); err != nil || len(shoppers) != 3 {
+		t.Fatal("failed to find shoppers", err)
+	}
+	tom, sam, lily := shoppers[0], shoppers[1], shoppers[2]
+	if len(tom.Baskets) != 2 || tom.Baskets[0].Total != 10 || tom.Baskets[1].Total != 20 {
+		t.Fatal("failed to preload has many, got", tom.Baskets)
+	}
+	if lily.Baskets == nil || len(lily.Baskets) != 0 || lily.Card != nil {
+		t.Fatal("expect no baskets and no card for Lily, got", lily.Baskets, lily.Card)
+	}
+	if sam.Card == nil || sam.Card.Number != "4242" || tom.Card != nil {
+		t.Fatal("failed to preload has one, got", sam.Card)
+	}
+}
+
+func TestSession_PreloadBelongsToAndNested(t *testing.T) {
+	s := testAssociationInit(t)
+
+	var basket Basket
+	if err := s.Preload("Shopper", "Items").Where("ID = ?", 1).First(&basket); err != nil {
+		t.Fatal(err)
+	}
+	if basket.Shopper == nil || basket.Shopper.Name != "Tom" || len(basket.Items) != 2 {
+		t.Fatal("failed to preload belongs to, got", basket.Shopper, basket.Items)
+	}
+
+	var shoppers []Shopper
+	if err := s.Preload("Baskets.Items").Where("Name = ?", "Sam").Find(&shoppers); err != nil || len(shoppers) != 1 {
+		t.Fatal("failed to find shoppers", err)
+	}
+	if baskets := shoppers[0].Baskets; len(baskets) != 1 || len(baskets[0].Items) != 1 || baskets[0].Items[0].Name != "Book" {
+		t.Fatal("failed to preload nested associations, got", baskets)
+	}
+
+	if err := s.Preload("Wallet").Find(&shoppers); err == nil {
+		t.Fatal("expect error preloading an unknown association")
+	}
+}
+
+func TestSession_PreloadQueries(t *testing.T) {
+	s := testAssociationInit(t)
+
+	var stmts []string
+	callbacks := NewCallbacks()
+	callbacks.Register(OpQuery, AfterStatement, "record", 0, func(s *Session) error {
+		sql, _ := s.Statement()
+		stmts = append(stmts, strings.TrimSpace(sql))
+		return nil
+	})
+
+	var shoppers []Shopper
+	if err := s.WithCallbacks(callbacks).Preload("Baskets").Find(&shoppers); err != nil {
+		t.Fatal(err)
+	}
+	// the baskets are loaded before the query of the shoppers is done
+	if len(stmts) != 2 || stmts[0] != `SELECT "ID", "ShopperID", "Total" FROM "Basket" WHERE "ShopperID" IN (?, ?, ?)` {
+		t.Fatal("expect one batched query for the baskets, got", stmts)
+	}
+}
+
+type Team struct {
+	ID      int64 `orm:"primary key;auto increment"`
+	Name    string
+	Players []Player
+}
+
+type Player struct {
+	ID     int64 `orm:"primary key;auto increment"`
+	TeamID int64
+	Name   string
+	Team   *Team
+}
+
+func TestSession_InsertAssociations(t *testing.T) {
+	s := testAssociationInit(t)
+
+	shopper := &Shopper{ID: 4, Name: "Ann", Card: &Card{ID: 2, Number: "1111"}, Baskets: []Basket{
+		{ID: 4, Total: 40, Items: []*Item{{ID: 4, Name: "Cup"}, {ID: 5, Name: "Mug"}}},
+	}}
+	if n, err := s.Insert(shopper); err != nil || n != 1 {
+		t.Fatal("failed to insert the shopper with associations", n, err)
+	}
+	var ann Shopper
+	if err := s.Preload("Card", "Baskets.Items").Where("ID = ?", 4).First(&ann); err != nil {
+		t.Fatal(err)
+	}
+	if ann.Card == nil || ann.Card.ShopperID != 4 || len(ann.Baskets) != 1 || len(ann.Baskets[0].Items) != 2 {
+		t.Fatal("failed to insert the associations, got", ann.Card, ann.Baskets)
+	}
+
+	// the basket belongs to Tom who exists already
+	if _, err := s.Insert(&Basket{ID: 5, Total: 50, Shopper: &Shopper{ID: 1, Name: "Tom"}}); err != nil {
+		t.Fatal(err)
+	}
+	var basket Basket
+	if err := s.Get(&basket, 5); err != nil || basket.ShopperID != 1 {
+		t.Fatal("failed to copy the key of the existing shopper", basket, err)
+	}
+
+	// a failing association rolls the whole insert back
+	c := NewCallbacks()
+	c.Register(OpCreate, BeforeStatement, "no cards", 0, func(s *Session) error {
+		if _, ok := s.Value().(*Card); ok {
+			return errors.New("cards are closed")
+		}
+		return nil
+	})
+	if _, err := s.WithCallbacks(c).Insert(&Shopper{ID: 5, Card: &Card{ID: 3}}); err == nil {
+		t.Fatal("expect error inserting the card")
+	}
+	if err := s.WithCallbacks(nil).Get(&Shopper{}, 5); err == nil {
+		t.Fatal("failed to roll back the shopper of the failed card")
+	}
+
+	// a saved card is moved to the shopper, not inserted again
+	if _, err := s.Insert(&Shopper{ID: 5, Card: &Card{ID: 1, Number: "4242"}}); err != nil {
+		t.Fatal("failed to insert the shopper with a saved card", err)
+	}
+	var card Card
+	if err := s.Get(&card, 1); err != nil || card.ShopperID != 5 {
+		t.Fatal("failed to move the saved card, got", card, err)
+	}
+	if n, _ := s.Model(&Card{}).Count(); n != 2 {
+		t.Fatal("expect 2 cards, got", n)
+	}
+
+	if _, err := s.OmitAssociations().Insert(&Shopper{ID: 6, Card: &Card{ID: 1}}); err != nil {
+		t.Fatal("expect the associations to be omitted", err)
+	}
+	if err := s.Get(&card, 1); err != nil || card.ShopperID != 5 {
+		t.Fatal("expect the omitted card to be left alone, got", card, err)
+	}
+}
+
+func TestSession_InsertGeneratedKeys(t *testing.T) {
+	s := NewSession()
+	for _, model := range []interface{}{&Team{}, &Player{}} {
+		if err1, err2 := s.Model(model).DropTable(), s.CreateTable(); err1 != nil || err2 != nil {
+			t.Fatal("failed to create tables", err1, err2)
+		}
+	}
+
+	teams := []Team{
+		{Name: "Red", Players: []Player{{Name: "Tom"}, {Name: "Sam"}}},
+		{Name: "Blue", Players: []Player{{Name: "Lily"}}},
+	}
+	if n, err := s.Insert(teams); err != nil || n != 2 {
+		t.Fatal("failed to insert the teams", n, err)
+	}
+	blue := teams[1]
+	if blue.ID == 0 || blue.Players[0].ID == 0 || blue.Players[0].TeamID != blue.ID {
+		t.Fatal("failed to propagate the generated keys, got", blue)
+	}
+
+	player := &Player{Name: "Ann", Team: &Team{Name: "Green"}}
+	if _, err := s.Insert(player); err != nil {
+		t.Fatal(err)
+	}
+	if player.Team.ID == 0 || player.TeamID != player.Team.ID {
+		t.Fatal("failed to insert the team of the player first, got", player.TeamID, player.Team)
+	}
+	if n, _ := s.Model(&Player{}).Count(); n != 4 {
+		t.Fatal("expect 4 players, got", n)
+	}
+}
+
+func TestSession_SubSavepoints(t *testing.T) {
+	var names []string
+	_, err := NewSession().Transaction(func(s *Session) (interface{}, error) {
+		return s.Transaction(func(s *Session) (interface{}, error) {
+			return s.sub().Transaction(func(sub *Session) (interface{}, error) {
+				names = append(names, s.savepoints...)
+				names = append(names, sub.savepoints...)
+				return nil, nil
+			})
+		})
+	})
+	if err != nil || !reflect.DeepEqual(names, []string{"sp_1", "sp_2"}) {
+		t.Fatal("expect the savepoint of a sub-session to follow the open ones, got", names, err)
+	}
+}
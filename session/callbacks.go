@@ -0,0 +1,188 @@
+package session
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"orm/log"
+)
+
+// Operation is the kind of statement a callback is registered for.
+type Operation int
+
+const (
+	// OpRaw is every statement run through Raw, including DDL.
+	OpRaw Operation = iota
+	OpCreate
+	OpQuery
+	OpUpdate
+	OpDelete
+)
+
+// When tells whether a callback runs before or after the statement.
+type When int
+
+const (
+	BeforeStatement When = iota
+	AfterStatement
+)
+
+// CallbackFunc is a plugin function run around statements. Callbacks run
+// before Insert, Find, Update, Delete and their variants build the SQL, so
+// they may still add conditions with Where. A returned error aborts the
+// operation.
+type CallbackFunc func(s *Session) error
+
+type callback struct {
+	name     string
+	priority int
+	seq      int
+	fn       CallbackFunc
+}
+
+type callbackKey struct {
+	op   Operation
+	when When
+}
+
+// Callbacks is a registry of callbacks shared by the sessions of an Engine,
+// for cross-cutting behavior such as tenant filters, auditing or metrics.
+type Callbacks struct {
+	mu        sync.RWMutex
+	seq       int
+	callbacks map[callbackKey][]*callback
+}
+
+func NewCallbacks() *Callbacks {
+	return &Callbacks{callbacks: make(map[callbackKey][]*callback)}
+}
+
+// Register adds the callback name run at when of op, replacing the callback
+// with the same name. Callbacks run in increasing priority, callbacks of the
+// same priority in the order they are registered.
+func (c *Callbacks) Register(op Operation, when When, name string, priority int, fn CallbackFunc) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := callbackKey{op, when}
+	c.seq++
+	cb := &callback{name: name, priority: priority, seq: c.seq, fn: fn}
+	callbacks := c.callbacks[key][:0:0]
+	for _, old := range c.callbacks[key] {
+		if old.name != name {
+			callbacks = append(callbacks, old)
+		}
+	}
+	callbacks = append(callbacks, cb)
+	sort.SliceStable(callbacks, func(i, j int) bool {
+		if callbacks[i].priority != callbacks[j].priority {
+			return callbacks[i].priority < callbacks[j].priority
+		}
+		return callbacks[i].seq < callbacks[j].seq
+	})
+	c.callbacks[key] = callbacks
+}
+
+// Remove removes the callback name run at when of op.
+func (c *Callbacks) Remove(op Operation, when When, name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := callbackKey{op, when}
+	callbacks := c.callbacks[key][:0:0]
+	for _, old := range c.callbacks[key] {
+		if old.name != name {
+			callbacks = append(callbacks, old)
+		}
+	}
+	c.callbacks[key] = callbacks
+}
+
+func (c *Callbacks) run(s *Session, op Operation, when When) error {
+	if c == nil {
+		return nil
+	}
+	c.mu.RLock()
+	callbacks := c.callbacks[callbackKey{op, when}]
+	c.mu.RUnlock()
+
+	for _, cb := range callbacks {
+		if err := cb.fn(s); err != nil {
+			log.Errorf("callback %s: %v", cb.name, err)
+			return err
+		}
+	}
+	return nil
+}
+
+// WithCallbacks makes the session run the callbacks of c.
+func (s *Session) WithCallbacks(c *Callbacks) *Session {
+	s.callbacks = c
+	return s
+}
+
+// Operation returns the operation being run, OpRaw outside of Insert,
+// Find, Update and Delete.
+func (s *Session) Operation() Operation {
+	return s.op
+}
+
+// Value returns the value the running operation reads or writes, e.g. the
+// records passed to Insert or the slice passed to Find.
+func (s *Session) Value() interface{} {
+	return s.value
+}
+
+// Statement returns the SQL and vars of the running statement, or of the
+// last one once it has run.
+func (s *Session) Statement() (string, []interface{}) {
+	return s.stmt, s.stmtVars
+}
+
+// enter runs the before callbacks of op, leave must be called once the
+// operation is done, it restores the outer operation if any.
+func (s *Session) enter(op Operation, value interface{}) (leave func(), err error) {
+	outerOp, outerValue := s.op, s.value
+	leave = func() {
+		s.op, s.value = outerOp, outerValue
+	}
+	s.op, s.value = op, value
+	s.stmt, s.stmtVars = "", nil
+	if err = s.callbacks.run(s, op, BeforeStatement); err != nil {
+		// the aborted statement must not leave its conditions to the next one
+		leave()
+		s.Clear()
+		return nil, err
+	}
+	return leave, nil
+}
+
+// done runs the after callbacks of the running operation.
+func (s *Session) done() error {
+	return s.callbacks.run(s, s.op, AfterStatement)
+}
+
+// beforeRaw runs the before callbacks of a statement run through Raw, the
+// statements of the other operations are covered by enter.
+func (s *Session) beforeRaw() error {
+	if s.op != OpRaw {
+		return nil
+	}
+	return s.callbacks.run(s, OpRaw, BeforeStatement)
+}
+
+func (s *Session) afterRaw() error {
+	if s.op != OpRaw {
+		return nil
+	}
+	return s.callbacks.run(s, OpRaw, AfterStatement)
+}
+
+// cancelled returns a context which is already done, it makes QueryRow fail
+// when a callback aborts the statement, as *sql.Row cannot hold the error.
+func cancelled(ctx context.Context) context.Context {
+	ctx, cancel := context.WithCancel(ctx)
+	cancel()
+	return ctx
+}
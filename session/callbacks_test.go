@@ -0,0 +1,141 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCallbacksOrder(t *testing.T) {
+	var calls []string
+	record := func(name string) CallbackFunc {
+		return func(s *Session) error {
+			calls = append(calls, name)
+			return nil
+		}
+	}
+
+	c := NewCallbacks()
+	c.Register(OpQuery, BeforeStatement, "metrics", 10, record("metrics"))
+	c.Register(OpQuery, BeforeStatement, "tenant", 0, record("tenant"))
+	c.Register(OpQuery, BeforeStatement, "audit", 10, record("audit"))
+	c.Register(OpQuery, AfterStatement, "after", 0, record("after"))
+	c.Register(OpQuery, BeforeStatement, "removed", 0, record("removed"))
+	c.Remove(OpQuery, BeforeStatement, "removed")
+
+	s := testRecordInit(t).WithCallbacks(c)
+	var users []User
+	if err := s.Find(&users); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(calls, []string{"tenant", "metrics", "audit", "after"}) {
+		t.Fatal("failed to run callbacks in order, got", calls)
+	}
+}
+
+func TestCallbacksFilter(t *testing.T) {
+	c := NewCallbacks()
+	c.Register(OpQuery, BeforeStatement, "tenant", 0, func(s *Session) error {
+		s.Where("Age > ?", 20)
+		return nil
+	})
+	c.Register(OpUpdate, BeforeStatement, "tenant", 0, func(s *Session) error {
+		s.Where("Age > ?", 20)
+		return nil
+	})
+
+	s := testRecordInit(t).WithCallbacks(c)
+	var users []User
+	if err := s.Find(&users); err != nil || len(users) != 1 || users[0].Name != "Sam" {
+		t.Fatal("failed to filter query by callback", users, err)
+	}
+	if count, err := s.Count(); err != nil || count != 1 {
+		t.Fatal("failed to filter count by callback", count, err)
+	}
+	if affected, err := s.Update("Age", 40); err != nil || affected != 1 {
+		t.Fatal("failed to filter update by callback", affected, err)
+	}
+}
+
+func TestCallbacksStatementsKeepConditions(t *testing.T) {
+	c := NewCallbacks()
+	c.Register(OpDelete, BeforeStatement, "audit", 0, func(s *Session) error {
+		_, err := s.Raw(`INSERT INTO "CallbackAudit" ("Action") VALUES (?)`, "delete").Exec()
+		return err
+	})
+
+	s := testRecordInit(t).WithCallbacks(c)
+	_, _ = s.Raw(`DROP TABLE IF EXISTS "CallbackAudit"`).Exec()
+	_, _ = s.Raw(`CREATE TABLE "CallbackAudit" ("Action" text)`).Exec()
+	if affected, err := s.Model(&User{}).Where("Name = ?", "Tom").Delete(); err != nil || affected != 1 {
+		t.Fatal("expect the callback not to widen the delete, got", affected, err)
+	}
+	if count, _ := s.Model(&User{}).Count(); count != 1 {
+		t.Fatal("expect 1 user left, got", count)
+	}
+}
+
+func TestCallbacksAbort(t *testing.T) {
+	var statements []string
+	c := NewCallbacks()
+	c.Register(OpCreate, BeforeStatement, "validate", 0, func(s *Session) error {
+		if u, ok := s.Value().(*User); ok && u.Name == "" {
+			return errors.New("name is required")
+		}
+		return nil
+	})
+	c.Register(OpCreate, AfterStatement, "audit", 0, func(s *Session) error {
+		sql, _ := s.Statement()
+		statements = append(statements, sql)
+		return nil
+	})
+	c.Register(OpRaw, BeforeStatement, "readonly", 0, func(s *Session) error {
+		if sql, _ := s.Statement(); strings.HasPrefix(sql, "DROP") {
+			return errors.New("drop is not allowed")
+		}
+		return nil
+	})
+
+	s := testRecordInit(t).WithCallbacks(c)
+	if _, err := s.Insert(&User{Age: 1}); err == nil {
+		t.Fatal("expect callback to abort the insert")
+	}
+	if _, err := s.Insert(&User{Name: "Lily", Age: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if len(statements) != 1 || !strings.HasPrefix(statements[0], "INSERT INTO") {
+		t.Fatal("failed to run after callback, got", statements)
+	}
+	if err := s.DropTable(); err == nil || !s.HasTable() {
+		t.Fatal("expect raw callback to abort the drop")
+	}
+	raws := 0
+	c.Register(OpRaw, AfterStatement, "count", 0, func(s *Session) error {
+		raws++
+		return nil
+	})
+	var name string
+	if err := s.Raw("DROP TABLE IF EXISTS missing").QueryRow().Scan(&name); !errors.Is(err, context.Canceled) || raws != 0 {
+		t.Fatal("expect an aborted query row to fail without after callbacks, got", err, raws)
+	}
+	if err := s.Raw("DROP TABLE IF EXISTS missing").ScanRow(&name); err == nil || err.Error() != "drop is not allowed" {
+		t.Fatal("expect the error of the callback, got", err)
+	}
+	abort := true
+	c.Register(OpQuery, BeforeStatement, "maintenance", 0, func(s *Session) error {
+		if abort {
+			return errors.New("under maintenance")
+		}
+		return nil
+	})
+	var users []User
+	if err := s.Where("Name = ?", "Lily").Find(&users); err == nil {
+		t.Fatal("expect callback to abort the query")
+	}
+	abort = false
+	if err := s.Find(&users); err != nil || len(users) != 3 {
+		t.Fatal("expect the aborted query not to leak its conditions, got", users, err)
+	}
+}
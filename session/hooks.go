@@ -46,41 +46,47 @@ type IAfterInsert interface {
 	AfterInsert(s *Session) error
 }
 
-func (s *Session) CallMethod(method MethodType, value interface{}) {
+// CallMethod calls the hook of value for method if it implements it, the
+// error of the hook is returned so it can abort the operation.
+func (s *Session) CallMethod(method MethodType, value interface{}) error {
+	if value == nil {
+		return nil
+	}
 	dest := reflect.ValueOf(value)
 	// 获取方法
 	switch method {
 	case BeforeQuery:
 		if v, ok := dest.Interface().(IBeforeQuery); ok {
-			v.BeforeQuery(s)
+			return v.BeforeQuery(s)
 		}
 	case AfterQuery:
 		if v, ok := dest.Interface().(IAfterQuery); ok {
-			v.AfterQuery(s)
+			return v.AfterQuery(s)
 		}
 	case BeforeUpdate:
 		if v, ok := dest.Interface().(IBeforeUpdate); ok {
-			v.BeforeUpdate(s)
+			return v.BeforeUpdate(s)
 		}
 	case AfterUpdate:
 		if v, ok := dest.Interface().(IAfterUpdate); ok {
-			v.AfterUpdate(s)
+			return v.AfterUpdate(s)
 		}
 	case BeforeDelete:
 		if v, ok := dest.Interface().(IBeforeDelete); ok {
-			v.BeforeDelete(s)
+			return v.BeforeDelete(s)
 		}
 	case AfterDelete:
 		if v, ok := dest.Interface().(IAfterDelete); ok {
-			v.AfterDelete(s)
+			return v.AfterDelete(s)
 		}
 	case BeforeInsert:
 		if v, ok := dest.Interface().(IBeforeInsert); ok {
-			v.BeforeInsert(s)
+			return v.BeforeInsert(s)
 		}
 	case AfterInsert:
 		if v, ok := dest.Interface().(IAfterInsert); ok {
-			v.AfterInsert(s)
+			return v.AfterInsert(s)
 		}
 	}
+	return nil
 }
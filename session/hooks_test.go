@@ -1,6 +1,8 @@
 package session
 
 import (
+	"errors"
+	"reflect"
 	"testing"
 
 	"orm/log"
@@ -45,3 +47,170 @@ func TestSessionCallMethod(t *testing.T) {
 		t.Fatal("failed to call hooks after query, got", u.Password)
 	}
 }
+
+type Member struct {
+	Name string `orm:"primary key"`
+	Age  int
+}
+
+func (m *Member) BeforeInsert(s *Session) error {
+	if m.Age < 0 {
+		return errors.New("age must not be negative")
+	}
+	return nil
+}
+
+func (m *Member) AfterQuery(s *Session) error {
+	if m.Name == "Bad" {
+		return errors.New("bad record")
+	}
+	return nil
+}
+
+func TestSessionHookAbort(t *testing.T) {
+	s := NewSession().Model(&Member{})
+	_ = s.DropTable()
+	_ = s.CreateTable()
+
+	if _, err := s.Insert([]*Member{{"Tom", 18}, {"Sam", -1}}); err == nil {
+		t.Fatal("expect BeforeInsert to abort the insert")
+	}
+	if count, _ := s.Count(); count != 0 {
+		t.Fatal("failed to abort insert, got records", count)
+	}
+
+	_, _ = s.Insert([]*Member{{"Tom", 18}, {"Bad", 20}})
+	var members []Member
+	if err := s.Find(&members); err == nil || err.Error() != "bad record" {
+		t.Fatal("expect AfterQuery to abort the query, got", err)
+	}
+}
+
+type Sealed struct {
+	ID int `orm:"primary key"`
+}
+
+func (v *Sealed) BeforeQuery(s *Session) error {
+	return errors.New("sealed")
+}
+
+func TestSessionHookAbortClears(t *testing.T) {
+	s := NewSession().Model(&Member{})
+	_ = s.DropTable()
+	_ = s.CreateTable()
+	_, _ = s.Insert([]*Member{{"Tom", 18}, {"Sam", 20}})
+
+	var sealed []Sealed
+	if err := s.Where("ID = ?", 1).Limit(1).Find(&sealed); err == nil {
+		t.Fatal("expect BeforeQuery to abort the query")
+	}
+	var members []Member
+	if err := s.Find(&members); err != nil || len(members) != 2 {
+		t.Fatal("expect the aborted query not to leak its conditions, got", members, err)
+	}
+
+	if _, err := s.Model(&Member{}).Where("Name = ?", "Tom").Insert(&Member{"Bad", -1}); err == nil {
+		t.Fatal("expect BeforeInsert to abort the insert")
+	}
+	if count, err := s.Model(&Member{}).Count(); err != nil || count != 2 {
+		t.Fatal("expect the aborted insert not to leak its conditions, got", count, err)
+	}
+}
+
+type Ticket struct {
+	ID     int `orm:"primary key"`
+	Status string
+
+	log []string
+}
+
+func (t *Ticket) BeforeUpdate(s *Session) error {
+	t.log = append(t.log, "before update")
+	return nil
+}
+
+func (t *Ticket) AfterUpdate(s *Session) error {
+	t.log = append(t.log, "after update")
+	return nil
+}
+
+func (t *Ticket) BeforeDelete(s *Session) error {
+	if t.Status == "locked" {
+		return errors.New("ticket is locked")
+	}
+	t.log = append(t.log, "before delete")
+	return nil
+}
+
+func (t *Ticket) AfterDelete(s *Session) error {
+	t.log = append(t.log, "after delete")
+	return nil
+}
+
+func TestSessionUpdateDeleteHooks(t *testing.T) {
+	s := NewSession().Model(&Ticket{})
+	_ = s.DropTable()
+	_ = s.CreateTable()
+	_, _ = s.Insert([]*Ticket{{ID: 1, Status: "open"}, {ID: 2, Status: "open"}})
+
+	ticket := &Ticket{}
+	if _, err := s.Model(ticket).Where("ID = ?", 1).Update("Status", "closed"); err != nil {
+		t.Fatal("failed to update ticket", err)
+	}
+	if _, err := s.Model(ticket).Where("ID = ?", 1).Delete(); err != nil {
+		t.Fatal("failed to delete ticket", err)
+	}
+	if !reflect.DeepEqual(ticket.log, []string{"before update", "after update", "before delete", "after delete"}) {
+		t.Fatal("failed to call update and delete hooks, got", ticket.log)
+	}
+
+	locked := &Ticket{ID: 2, Status: "locked"}
+	if _, err := s.Save(locked); err != nil || !reflect.DeepEqual(locked.log, []string{"before update", "after update"}) {
+		t.Fatal("failed to call update hooks from Save, got", locked.log, err)
+	}
+	if _, err := s.DeleteModel(locked); err == nil {
+		t.Fatal("expect BeforeDelete to abort the delete")
+	}
+	if count, _ := s.Count(); count != 1 {
+		t.Fatal("failed to abort delete, got records", count)
+	}
+}
+
+type Ledger struct {
+	ID      int `orm:"primary key"`
+	Balance int
+}
+
+// BeforeUpdate and BeforeDelete audit the change on the session of the
+// operation.
+func (l *Ledger) BeforeUpdate(s *Session) error {
+	_, err := s.Raw(`INSERT INTO "LedgerAudit" ("Action") VALUES (?)`, "update").Exec()
+	return err
+}
+
+func (l *Ledger) BeforeDelete(s *Session) error {
+	_, err := s.Raw(`INSERT INTO "LedgerAudit" ("Action") VALUES (?)`, "delete").Exec()
+	return err
+}
+
+func TestSessionHookStatementsKeepConditions(t *testing.T) {
+	s := NewSession()
+	_, _ = s.Raw(`DROP TABLE IF EXISTS "LedgerAudit"`).Exec()
+	_, _ = s.Raw(`CREATE TABLE "LedgerAudit" ("Action" text)`).Exec()
+	s.Model(&Ledger{})
+	_ = s.DropTable()
+	_ = s.CreateTable()
+	_, _ = s.Insert([]*Ledger{{1, 10}, {2, 20}, {3, 30}})
+
+	if n, err := s.Model(&Ledger{}).Where("ID = ?", 1).Update("Balance", 0); err != nil || n != 1 {
+		t.Fatal("expect the hook not to widen the update, got", n, err)
+	}
+	if n, err := s.Model(&Ledger{}).Where("ID = ?", 1).Delete(); err != nil || n != 1 {
+		t.Fatal("expect the hook not to widen the delete, got", n, err)
+	}
+	var audits int64
+	_ = s.Raw(`SELECT count(*) FROM "LedgerAudit"`).QueryRow().Scan(&audits)
+	if count, _ := s.Model(&Ledger{}).Count(); count != 2 || audits != 2 {
+		t.Fatal("expect 2 ledgers and 2 audits, got", count, audits)
+	}
+}
@@ -0,0 +1,140 @@
+package session
+
+import (
+	"database/sql"
+	"fmt"
+	"reflect"
+	"time"
+
+	"orm/clause"
+	"orm/schema"
+)
+
+// Joins joins table with an inner join, on is the ON condition:
+//
+//	s.Model(&User{}).Joins("Order", `"Order"."UserID" = "User"."ID"`).Find(&results)
+func (s *Session) Joins(table string, on interface{}, args ...interface{}) *Session {
+	s.clause.AddJoin(clause.Join{Kind: "JOIN", Table: table, On: condition(on, args...)})
+	return s
+}
+
+// LeftJoin joins table with a left outer join.
+func (s *Session) LeftJoin(table string, on interface{}, args ...interface{}) *Session {
+	s.clause.AddJoin(clause.Join{Kind: "LEFT JOIN", Table: table, On: condition(on, args...)})
+	return s
+}
+
+var (
+	timeType    = reflect.TypeOf(time.Time{})
+	scannerType = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+)
+
+// modelType returns the struct type of a field holding a model, User or
+// *User, or nil for a column value.
+func modelType(typ reflect.Type) reflect.Type {
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if typ.Kind() != reflect.Struct || typ == timeType || reflect.PtrTo(typ).Implements(scannerType) {
+		return nil
+	}
+	return typ
+}
+
+// isComposite reports whether typ embeds or nests models, as the result of a
+// join such as struct { User; Order *Order; Total float64 }. The association
+// fields of a model are not parts of a composite.
+func (s *Session) isComposite(typ reflect.Type) bool {
+	var table *schema.Schema
+	for i := 0; i < typ.NumField(); i++ {
+		p := typ.Field(i)
+		if !p.IsExported() || modelType(p.Type) == nil {
+			continue
+		}
+		if p.Anonymous {
+			return true
+		}
+		if table == nil {
+			var err error
+			if table, err = schema.Parse(reflect.New(typ).Interface(), s.dialect); err != nil {
+				return true
+			}
+		}
+		if table.GetRelationship(p.Name) == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// columnTarget is the destination field of a result column.
+type columnTarget struct {
+	index []int // index of the field in the destination struct
+	typ   reflect.Type
+	// nullable targets are scanned through a pointer, so NULL columns of a
+	// left join leave the field, or its nested model, unset
+	nullable bool
+}
+
+func (t *columnTarget) value(dest reflect.Value) interface{} {
+	if t.nullable {
+		return reflect.New(reflect.PtrTo(t.typ)).Interface()
+	}
+	return dest.FieldByIndex(t.index).Addr().Interface()
+}
+
+func (t *columnTarget) assign(dest reflect.Value, value interface{}) {
+	if !t.nullable {
+		return
+	}
+	ptr := reflect.ValueOf(value).Elem()
+	if ptr.IsNil() {
+		return
+	}
+
+	// allocate the nested models on the way, e.g. Order *Order
+	v := dest
+	for _, i := range t.index {
+		if v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(i)
+	}
+	v.Set(ptr.Elem())
+}
+
+// compositeColumns maps the labels of the columns of a composite result to
+// their target, labels are "Order.ID" for the fields of models and the field
+// name otherwise. selects are the default select list, one aliased column
+// per field of the nested models.
+func (s *Session) compositeColumns(typ reflect.Type) (targets map[string]*columnTarget, selects []string, err error) {
+	targets = make(map[string]*columnTarget)
+	for i := 0; i < typ.NumField(); i++ {
+		p := typ.Field(i)
+		if !p.IsExported() {
+			continue
+		}
+
+		partType := modelType(p.Type)
+		if partType == nil {
+			targets[p.Name] = &columnTarget{index: []int{i}, typ: p.Type, nullable: true}
+			continue
+		}
+
+		part, err := schema.Parse(reflect.New(partType).Interface(), s.dialect)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, field := range part.Fields {
+			f, _ := partType.FieldByName(field.Name)
+			label := p.Name + "." + field.Column
+			targets[label] = &columnTarget{index: append([]int{i}, f.Index...), typ: f.Type, nullable: true}
+			selects = append(selects, fmt.Sprintf("%s AS %s",
+				s.clause.Quote(part.Name+"."+field.Column), s.dialect.Quote(label)))
+		}
+	}
+	return targets, selects, nil
+}
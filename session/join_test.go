@@ -0,0 +1,66 @@
+package session
+
+import "testing"
+
+type UserPurchase struct {
+	User
+	Purchase *Purchase
+}
+
+func testJoinInit(t *testing.T) *Session {
+	t.Helper()
+	testPurchaseInit(t)
+	return testRecordInit(t)
+}
+
+func TestSession_Joins(t *testing.T) {
+	s := testJoinInit(t)
+
+	var results []UserPurchase
+	err := s.Model(&User{}).Joins("Purchase", `"Purchase"."Customer" = "User"."Name"`).
+		OrderBy(`"Purchase"."ID"`).Find(&results)
+	if err != nil || len(results) != 3 {
+		t.Fatal("failed to join purchases", results, err)
+	}
+	if results[0].Name != "Tom" || results[0].Age != 18 || results[0].Purchase.ID != 1 ||
+		results[2].Name != "Sam" || results[2].Purchase.Total != 60 {
+		t.Fatal("failed to scan joined models", results[0], results[2])
+	}
+
+	var users []User
+	err = s.Joins("Purchase", `"Purchase"."Customer" = "User"."Name"`).
+		Where(`"Purchase"."Total" > ?`, 70).Find(&users)
+	if err != nil || len(users) != 1 || users[0].Name != "Tom" {
+		t.Fatal("failed to filter by joined table", users, err)
+	}
+}
+
+func TestSession_LeftJoin(t *testing.T) {
+	s := testJoinInit(t)
+	_, _ = s.Insert(&User{"Lily", 30})
+
+	var results []UserPurchase
+	err := s.Model(&User{}).LeftJoin("Purchase", `"Purchase"."Customer" = "User"."Name"`).
+		Where(`"User"."Name" = ?`, "Lily").Find(&results)
+	if err != nil || len(results) != 1 || results[0].Name != "Lily" || results[0].Purchase != nil {
+		t.Fatal("failed to left join without match", results, err)
+	}
+}
+
+func TestSession_JoinAlias(t *testing.T) {
+	s := testJoinInit(t)
+
+	var totals []struct {
+		User
+		Total float64
+	}
+	err := s.Model(&User{}).Joins("Purchase", `"Purchase"."Customer" = "User"."Name"`).
+		Select(`"User"."Name" AS "User.Name"`, `SUM("Purchase"."Total") AS Total`).
+		Group("User.Name").OrderBy(`"User"."Name"`).Find(&totals)
+	if err != nil || len(totals) != 2 {
+		t.Fatal("failed to query aliased columns", totals, err)
+	}
+	if totals[0].Name != "Sam" || totals[0].Total != 60 || totals[1].Name != "Tom" || totals[1].Total != 120 {
+		t.Fatal("failed to map aliased columns", totals)
+	}
+}
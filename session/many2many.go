@@ -0,0 +1,347 @@
+package session
+
+import (
+	"fmt"
+	"reflect"
+
+	"orm/clause"
+	"orm/schema"
+)
+
+// links returns the rows of the join table whose owner key is one of keys,
+// as pairs of owner and associated keys.
+func (s *Session) links(join *schema.Schema, keys []interface{}) (owners, related []interface{}, err error) {
+	if len(keys) == 0 {
+		return nil, nil, nil
+	}
+	joinType := reflect.Indirect(reflect.ValueOf(join.Model)).Type()
+	s.clause.Set(clause.SELECT, join.Name, join.FieldNames)
+	s.clause.AndWhere(clause.In(s.dialect.Quote(join.Fields[0].Column), keys...))
+	sql, vars := s.clause.Build(clause.SELECT, clause.WHERE)
+	rows, err := s.Raw(sql, vars...).QueryRows()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		owner, elem := reflect.New(joinType.Field(0).Type), reflect.New(joinType.Field(1).Type)
+		if err := rows.Scan(owner.Interface(), elem.Interface()); err != nil {
+			return nil, nil, err
+		}
+		owners, related = append(owners, keyOf(owner)), append(related, keyOf(elem))
+	}
+	return owners, related, rows.Err()
+}
+
+// preloadJoinTable loads the ManyToMany association rel into records, the
+// links with one query on the join table and the models with another.
+func (s *Session) preloadJoinTable(table *schema.Schema, rel *schema.Relationship, records reflect.Value, nested []string) error {
+	join, err := table.JoinTable(rel, s.dialect)
+	if err != nil {
+		return err
+	}
+	owners, related, err := s.sub().links(join, ownerKeys(records, rel.References))
+	if err != nil {
+		return err
+	}
+
+	// a model linked to several records is loaded once
+	var keys []interface{}
+	seen := make(map[interface{}]bool)
+	for _, key := range related {
+		if !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	results := reflect.New(reflect.SliceOf(rel.Type))
+	if len(keys) > 0 {
+		sub := s.sub()
+		relTable := sub.Model(reflect.New(rel.Type).Interface()).RefTable()
+		if relTable == nil {
+			return sub.ModelError()
+		}
+		column := s.dialect.Quote(relTable.LookUpField(rel.ForeignKey).Column)
+		if err := sub.Preload(nested...).Where(clause.In(column, keys...)).Find(results.Interface()); err != nil {
+			return err
+		}
+	}
+
+	found := make(map[interface{}]reflect.Value)
+	for i := 0; i < results.Elem().Len(); i++ {
+		result := results.Elem().Index(i)
+		found[keyOf(result.FieldByName(rel.ForeignKey))] = result
+	}
+	matches := make(map[interface{}][]reflect.Value)
+	for i, owner := range owners {
+		if result, ok := found[related[i]]; ok {
+			matches[owner] = append(matches[owner], result)
+		}
+	}
+
+	for i := 0; i < records.Len(); i++ {
+		record := records.Index(i)
+		field := record.FieldByName(rel.Name)
+		linked := matches[keyOf(record.FieldByName(rel.References))]
+		slice := reflect.MakeSlice(field.Type(), 0, len(linked))
+		for _, result := range linked {
+			slice = reflect.Append(slice, as(result, field.Type().Elem()))
+		}
+		field.Set(slice)
+	}
+	return nil
+}
+
+// Association is the many-to-many association of a record, returned by
+// Session.Association. Its methods change the links in the join table and
+// the association field of the record alike.
+type Association struct {
+	s      *Session
+	rel    *schema.Relationship
+	join   *schema.Schema
+	record reflect.Value // the owner struct
+	key    interface{}   // key of the owner
+	err    error
+}
+
+// Association returns the many-to-many association name of value, a pointer
+// to a saved model, e.g. s.Association(&user, "Roles").Append(&admin). An
+// invalid association is reported by the methods.
+func (s *Session) Association(value interface{}, name string) *Association {
+	a := &Association{s: s}
+	v := reflect.ValueOf(value)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		a.err = fmt.Errorf("association %s: %T is not a pointer to a model", name, value)
+		return a
+	}
+	table, err := schema.Parse(value, s.dialect)
+	if err != nil {
+		a.err = err
+		return a
+	}
+	if a.rel = table.GetRelationship(name); a.rel == nil || a.rel.Kind != schema.ManyToMany {
+		a.err = fmt.Errorf("model %s has no many-to-many association %s", table.Name, name)
+		return a
+	}
+	if a.join, a.err = table.JoinTable(a.rel, s.dialect); a.err != nil {
+		return a
+	}
+	a.record = v.Elem()
+	key := a.record.FieldByName(a.rel.References)
+	if key.IsZero() {
+		a.err = fmt.Errorf("association %s: the %s has no key, insert it first", name, table.Name)
+	}
+	a.key = key.Interface()
+	return a
+}
+
+// models returns the associated models in values, each a model, a pointer to
+// one or a slice of either. Models passed by pointer or in a slice are
+// updated in place when they are inserted.
+func (a *Association) models(values []interface{}) ([]reflect.Value, error) {
+	if a.err != nil {
+		return nil, a.err
+	}
+	var models []reflect.Value
+	var add func(v reflect.Value) error
+	add = func(v reflect.Value) error {
+		switch {
+		case !v.IsValid():
+			return fmt.Errorf("association %s: nil model", a.rel.Name)
+		case v.Kind() == reflect.Ptr && v.Type().Elem() == a.rel.Type && !v.IsNil():
+			models = append(models, v.Elem())
+		case v.Type() == a.rel.Type:
+			if !v.CanAddr() {
+				model := reflect.New(a.rel.Type).Elem()
+				model.Set(v)
+				v = model
+			}
+			models = append(models, v)
+		case v.Kind() == reflect.Slice:
+			for i := 0; i < v.Len(); i++ {
+				if err := add(v.Index(i)); err != nil {
+					return err
+				}
+			}
+		default:
+			return fmt.Errorf("association %s: %s is not a %s", a.rel.Name, v.Type(), a.rel.Type.Name())
+		}
+		return nil
+	}
+	for _, value := range values {
+		if err := add(reflect.ValueOf(value)); err != nil {
+			return nil, err
+		}
+	}
+	return models, nil
+}
+
+func (a *Association) keyOf(model reflect.Value) interface{} {
+	return keyOf(model.FieldByName(a.rel.ForeignKey))
+}
+
+// owned is the condition matching the links of the record.
+func (a *Association) owned() clause.Condition {
+	return clause.Expr(a.s.dialect.Quote(a.join.Fields[0].Column)+" = ?", a.key)
+}
+
+// link inserts the models which do not exist and the missing links to them.
+func (a *Association) link(s *Session, models []reflect.Value) error {
+	_, linked, err := s.sub().links(a.join, []interface{}{a.key})
+	if err != nil {
+		return err
+	}
+	exists := make(map[interface{}]bool)
+	for _, key := range linked {
+		exists[key] = true
+	}
+
+	var rows []interface{}
+	for _, model := range models {
+		if err := s.insertMissing(model); err != nil {
+			return err
+		}
+		key := model.FieldByName(a.rel.ForeignKey)
+		if k := keyOf(key); !exists[k] {
+			exists[k] = true
+			rows = append(rows, []interface{}{a.key, key.Interface()})
+		}
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+
+	sub := s.sub()
+	sub.clause.Set(clause.INSERT, a.join.Name, a.join.FieldNames)
+	sub.clause.Set(clause.VALUES, rows...)
+	sql, vars := sub.clause.Build(clause.INSERT, clause.VALUES)
+	_, err = sub.Raw(sql, vars...).Exec()
+	return err
+}
+
+// unlink deletes the links to the models, every link of the record when
+// models is nil.
+func (a *Association) unlink(s *Session, models []reflect.Value) error {
+	sub := s.sub()
+	sub.clause.Set(clause.DELETE, a.join.Name)
+	sub.clause.AndWhere(a.owned())
+	if models != nil {
+		keys := make([]interface{}, 0, len(models))
+		for _, model := range models {
+			keys = append(keys, a.keyOf(model))
+		}
+		sub.clause.AndWhere(clause.In(s.dialect.Quote(a.join.Fields[1].Column), keys...))
+	}
+	sql, vars := sub.clause.Build(clause.DELETE, clause.WHERE)
+	_, err := sub.Raw(sql, vars...).Exec()
+	return err
+}
+
+// set replaces the association field of the record by the models it holds
+// which keep returns true for, followed by the models not already in it.
+func (a *Association) set(keep func(reflect.Value) bool, models []reflect.Value) {
+	field := a.record.FieldByName(a.rel.Name)
+	elemType := field.Type().Elem()
+	slice := reflect.MakeSlice(field.Type(), 0, field.Len()+len(models))
+	held := make(map[interface{}]bool)
+	for i := 0; i < field.Len(); i++ {
+		model := reflect.Indirect(field.Index(i))
+		if model.IsValid() && keep(model) {
+			held[a.keyOf(model)] = true
+			slice = reflect.Append(slice, field.Index(i))
+		}
+	}
+	for _, model := range models {
+		if key := a.keyOf(model); !held[key] {
+			held[key] = true
+			slice = reflect.Append(slice, as(model, elemType))
+		}
+	}
+	field.Set(slice)
+}
+
+func keepAll(reflect.Value) bool  { return true }
+func keepNone(reflect.Value) bool { return false }
+
+// Append links the models to the record, inserting those which do not exist
+// first. Links which exist already are kept.
+func (a *Association) Append(values ...interface{}) error {
+	models, err := a.models(values)
+	if err != nil {
+		return err
+	}
+	_, err = a.s.Transaction(func(s *Session) (interface{}, error) {
+		return nil, a.link(s, models)
+	})
+	if err != nil {
+		return err
+	}
+	a.set(keepAll, models)
+	return nil
+}
+
+// Replace links the record to the models only, the links to other models
+// are deleted.
+func (a *Association) Replace(values ...interface{}) error {
+	models, err := a.models(values)
+	if err != nil {
+		return err
+	}
+	_, err = a.s.Transaction(func(s *Session) (interface{}, error) {
+		if err := a.unlink(s, nil); err != nil {
+			return nil, err
+		}
+		return nil, a.link(s, models)
+	})
+	if err != nil {
+		return err
+	}
+	a.set(keepNone, models)
+	return nil
+}
+
+// Delete deletes the links to the models, the models themselves are kept.
+func (a *Association) Delete(values ...interface{}) error {
+	models, err := a.models(values)
+	if err != nil || len(models) == 0 {
+		return err
+	}
+	if err := a.unlink(a.s, models); err != nil {
+		return err
+	}
+	deleted := make(map[interface{}]bool)
+	for _, model := range models {
+		deleted[a.keyOf(model)] = true
+	}
+	a.set(func(model reflect.Value) bool { return !deleted[a.keyOf(model)] }, nil)
+	return nil
+}
+
+// Clear deletes every link of the record, the models are kept.
+func (a *Association) Clear() error {
+	if a.err != nil {
+		return a.err
+	}
+	if err := a.unlink(a.s, nil); err != nil {
+		return err
+	}
+	a.set(keepNone, nil)
+	return nil
+}
+
+// Count returns the number of models linked to the record.
+func (a *Association) Count() (int64, error) {
+	if a.err != nil {
+		return 0, a.err
+	}
+	sub := a.s.sub()
+	sub.clause.Set(clause.COUNT, a.join.Name)
+	sub.clause.AndWhere(a.owned())
+	sql, vars := sub.clause.Build(clause.COUNT, clause.WHERE)
+	var count int64
+	if err := sub.Raw(sql, vars...).ScanRow(&count); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
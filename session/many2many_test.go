@@ -0,0 +1,127 @@
+package session
+
+import "testing"
+
+type Student struct {
+	ID      int `orm:"primary key"`
+	Name    string
+	Courses []*Course `orm:"many2many:enrollments"`
+}
+
+type Course struct {
+	ID    int64 `orm:"primary key;auto increment"`
+	Title string
+}
+
+func testManyToManyInit(t *testing.T) (*Session, *Student) {
+	t.Helper()
+	s := NewSession()
+	_, err1 := s.Raw("DROP TABLE IF EXISTS enrollments;").Exec()
+	err2 := s.Model(&Course{}).DropTable()
+	err3 := s.CreateTable()
+	err4 := s.Model(&Student{}).DropTable()
+	err5 := s.CreateTable()
+	tom := &Student{ID: 1, Name: "Tom"}
+	_, err6 := s.Insert([]*Student{tom, {ID: 2, Name: "Sam"}})
+	for _, err := range []error{err1, err2, err3, err4, err5, err6} {
+		if err != nil {
+			t.Fatal("failed init many to many records", err)
+		}
+	}
+	return s, tom
+}
+
+func TestSession_Association(t *testing.T) {
+	s, tom := testManyToManyInit(t)
+	math, art := &Course{Title: "Math"}, &Course{Title: "Art"}
+
+	courses := s.Association(tom, "Courses")
+	if err := courses.Append(math, art); err != nil {
+		t.Fatal(err)
+	}
+	if math.ID == 0 || art.ID == 0 || len(tom.Courses) != 2 {
+		t.Fatal("failed to insert the appended courses", math, art, tom.Courses)
+	}
+	if err := courses.Append(math); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := courses.Count(); err != nil || n != 2 || len(tom.Courses) != 2 {
+		t.Fatal("expect appending a linked course to be ignored", n, err)
+	}
+
+	if err := courses.Delete(art); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := courses.Count(); n != 1 || len(tom.Courses) != 1 || tom.Courses[0] != math {
+		t.Fatal("failed to delete the link to art", n, tom.Courses)
+	}
+	if n, _ := s.Model(&Course{}).Count(); n != 2 {
+		t.Fatal("expect deleting a link to keep the course, got", n)
+	}
+
+	if err := courses.Replace([]*Course{art}); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := courses.Count(); n != 1 || len(tom.Courses) != 1 || tom.Courses[0].Title != "Art" {
+		t.Fatal("failed to replace the courses", n, tom.Courses)
+	}
+
+	if err := courses.Clear(); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := courses.Count(); n != 0 || len(tom.Courses) != 0 {
+		t.Fatal("failed to clear the courses", n, tom.Courses)
+	}
+
+	if err := s.Association(tom, "Name").Append(math); err == nil {
+		t.Fatal("expect error for a field which is not a many to many association")
+	}
+	if _, err := s.Association(&Student{}, "Courses").Count(); err == nil {
+		t.Fatal("expect error for a record without key")
+	}
+	if err := courses.Append(tom); err == nil {
+		t.Fatal("expect error appending a model of another type")
+	}
+}
+
+func TestSession_PreloadManyToMany(t *testing.T) {
+	s, tom := testManyToManyInit(t)
+	math, art := &Course{Title: "Math"}, &Course{Title: "Art"}
+	sam := &Student{ID: 2}
+	if err := s.Association(tom, "Courses").Append(math, art); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Association(sam, "Courses").Append(math); err != nil {
+		t.Fatal(err)
+	}
+
+	var students []Student
+	if err := s.Preload("Courses").OrderBy("ID").Find(&students); err != nil || len(students) != 2 {
+		t.Fatal("failed to find students", err)
+	}
+	if courses := students[0].Courses; len(courses) != 2 {
+		t.Fatal("failed to preload the courses of Tom, got", courses)
+	}
+	if courses := students[1].Courses; len(courses) != 1 || courses[0].Title != "Math" {
+		t.Fatal("failed to preload the courses of Sam, got", courses)
+	}
+}
+
+func TestSession_InsertManyToMany(t *testing.T) {
+	s, _ := testManyToManyInit(t)
+	math := &Course{Title: "Math"}
+	if _, err := s.Insert(math); err != nil {
+		t.Fatal(err)
+	}
+
+	lily := &Student{ID: 3, Name: "Lily", Courses: []*Course{math, {Title: "Art"}}}
+	if _, err := s.Insert(lily); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := s.Model(&Course{}).Count(); n != 2 || lily.Courses[1].ID == 0 {
+		t.Fatal("expect only the new course to be inserted, got", n)
+	}
+	if n, err := s.Association(lily, "Courses").Count(); err != nil || n != 2 {
+		t.Fatal("failed to link the courses", n, err)
+	}
+}
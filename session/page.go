@@ -0,0 +1,196 @@
+package session
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"orm/clause"
+	"orm/schema"
+)
+
+// Paginate selects the page-th page (1-based) of size records with
+// LIMIT and OFFSET.
+func (s *Session) Paginate(page, size int) *Session {
+	if page < 1 {
+		page = 1
+	}
+	return s.Limit(size).Offset((page - 1) * size)
+}
+
+// After makes the next FindPage continue after the cursor it returned
+// earlier, an empty cursor starts from the first page.
+func (s *Session) After(cursor string) *Session {
+	s.after = cursor
+	return s
+}
+
+// cursor is the decoded form of the opaque cursor of FindPage, the values of
+// the ORDER BY columns of the last record of a page.
+type cursor struct {
+	Columns []string          `json:"c"`
+	Values  []json.RawMessage `json:"v"`
+}
+
+// orderColumn is one term of ORDER BY.
+type orderColumn struct {
+	field *schema.Field
+	desc  bool
+}
+
+// orderColumns parses the ORDER BY set with OrderBy, then appends the primary
+// key so the order is total and every record is on exactly one page.
+func orderColumns(table *schema.Schema, orderBy string) ([]orderColumn, error) {
+	var columns []orderColumn
+	seen := make(map[*schema.Field]bool)
+	for _, term := range strings.Split(orderBy, ",") {
+		parts := strings.Fields(term)
+		if len(parts) == 0 {
+			continue
+		}
+		desc := false
+		if len(parts) == 2 && strings.EqualFold(parts[1], "DESC") {
+			desc = true
+		} else if len(parts) > 2 || len(parts) == 2 && !strings.EqualFold(parts[1], "ASC") {
+			return nil, fmt.Errorf("cannot paginate on ORDER BY %q", strings.TrimSpace(term))
+		}
+
+		// "User"."Name" and Name both name the column Name
+		name := parts[0]
+		name = name[strings.LastIndex(name, ".")+1:]
+		field := table.GetField(strings.Trim(name, "\"`"))
+		if field == nil {
+			return nil, fmt.Errorf("cannot paginate on ORDER BY %q, it is not a column of %s", parts[0], table.Name)
+		}
+		if !seen[field] {
+			seen[field] = true
+			columns = append(columns, orderColumn{field: field, desc: desc})
+		}
+	}
+
+	for _, field := range table.PrimaryKeys {
+		if !seen[field] {
+			columns = append(columns, orderColumn{field: field})
+		}
+	}
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("cannot paginate %s without ORDER BY or primary key", table.Name)
+	}
+	return columns, nil
+}
+
+// keysetCondition returns the condition of the records after the cursor,
+// (c1 > v1) OR (c1 = v1 AND c2 > v2) OR ..., with < for DESC columns.
+func keysetCondition(table *schema.Schema, columns []orderColumn, quote func(string) string, values []interface{}) clause.Condition {
+	var conds []clause.Condition
+	for i, column := range columns {
+		var terms []clause.Condition
+		for j := 0; j < i; j++ {
+			terms = append(terms, clause.Expr(quote(table.Name+"."+columns[j].field.Column)+" = ?", values[j]))
+		}
+		op := ">"
+		if column.desc {
+			op = "<"
+		}
+		terms = append(terms, clause.Expr(fmt.Sprintf("%s %s ?", quote(table.Name+"."+column.field.Column), op), values[i]))
+		conds = append(conds, clause.And(terms...))
+	}
+	return clause.Or(conds...)
+}
+
+func encodeCursor(columns []orderColumn, last reflect.Value) (string, error) {
+	c := cursor{}
+	for _, column := range columns {
+		value, err := json.Marshal(last.FieldByName(column.field.Name).Interface())
+		if err != nil {
+			return "", err
+		}
+		c.Columns = append(c.Columns, column.field.Column)
+		c.Values = append(c.Values, value)
+	}
+	data, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// decodeCursor returns the values of the cursor, typed like the fields of
+// modelType so they compare with the columns the way the stored values do.
+func decodeCursor(s string, columns []orderColumn, modelType reflect.Type) ([]interface{}, error) {
+	invalid := errors.New("invalid pagination cursor")
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, invalid
+	}
+	var c cursor
+	if err := json.Unmarshal(data, &c); err != nil || len(c.Columns) != len(columns) || len(c.Values) != len(columns) {
+		return nil, invalid
+	}
+
+	values := make([]interface{}, 0, len(columns))
+	for i, column := range columns {
+		if c.Columns[i] != column.field.Column {
+			return nil, errors.New("pagination cursor does not match ORDER BY")
+		}
+		f, _ := modelType.FieldByName(column.field.Name)
+		value := reflect.New(f.Type)
+		if err := json.Unmarshal(c.Values[i], value.Interface()); err != nil {
+			return nil, invalid
+		}
+		values = append(values, value.Elem().Interface())
+	}
+	return values, nil
+}
+
+// FindPage appends at most size records, in the order set by OrderBy, to the
+// slice values points to, starting after the cursor given by After. It
+// returns the cursor of the next page, "" when this page is the last one.
+//
+//	next, err := s.OrderBy("Age DESC").After(cursor).FindPage(&users, 20)
+func (s *Session) FindPage(values interface{}, size int) (next string, err error) {
+	if size <= 0 {
+		return "", errors.New("page size must be positive")
+	}
+	destSlice := reflect.Indirect(reflect.ValueOf(values))
+	destType := destSlice.Type().Elem()
+	table := s.Model(reflect.New(destType).Interface()).RefTable()
+	if table == nil {
+		return "", s.ModelError()
+	}
+
+	columns, err := orderColumns(table, s.orderBy)
+	if err != nil {
+		return "", err
+	}
+	if s.after != "" {
+		after, err := decodeCursor(s.after, columns, destType)
+		if err != nil {
+			return "", err
+		}
+		s.clause.AndWhere(keysetCondition(table, columns, s.clause.Quote, after))
+	}
+
+	var orders []string
+	for _, column := range columns {
+		order := s.clause.Quote(table.Name + "." + column.field.Column)
+		if column.desc {
+			order += " DESC"
+		}
+		orders = append(orders, order)
+	}
+
+	// one more record than asked tells whether there is a next page
+	start := destSlice.Len()
+	if err := s.OrderBy(strings.Join(orders, ", ")).Limit(size + 1).Find(values); err != nil {
+		return "", err
+	}
+	if destSlice.Len()-start <= size {
+		return "", nil
+	}
+	destSlice.SetLen(start + size)
+	return encodeCursor(columns, destSlice.Index(start+size-1))
+}
@@ -0,0 +1,65 @@
+package session
+
+import "testing"
+
+func TestSession_Paginate(t *testing.T) {
+	s := testPurchaseInit(t)
+	var purchases []Purchase
+	if err := s.OrderBy("ID").Paginate(2, 3).Find(&purchases); err != nil || len(purchases) != 1 || purchases[0].ID != 4 {
+		t.Fatal("failed to query the second page", purchases, err)
+	}
+
+	purchases = nil
+	if err := s.OrderBy("ID").Limit(2).Offset(1).Find(&purchases); err != nil || len(purchases) != 2 || purchases[0].ID != 2 {
+		t.Fatal("failed to query with offset", purchases, err)
+	}
+}
+
+func TestSession_FindPage(t *testing.T) {
+	s := testPurchaseInit(t)
+
+	var page []Purchase
+	next, err := s.OrderBy("Total DESC").FindPage(&page, 3)
+	if err != nil || next == "" || len(page) != 3 || page[0].Total != 150 || page[2].Total != 60 {
+		t.Fatal("failed to query the first page", page, err)
+	}
+
+	page = nil
+	next, err = s.OrderBy("Total DESC").After(next).FindPage(&page, 3)
+	if err != nil || next != "" || len(page) != 1 || page[0].Total != 40 {
+		t.Fatal("failed to query the last page", page, next, err)
+	}
+
+	if _, err := s.OrderBy("Customer").After("bad cursor").FindPage(&page, 3); err == nil {
+		t.Fatal("expect error for invalid cursor")
+	}
+}
+
+func TestSession_FindPageTies(t *testing.T) {
+	s := testPurchaseInit(t)
+
+	// Tom has two purchases, the primary key keeps them in order
+	var ids []int
+	var next string
+	for i := 0; i < 4; i++ {
+		var page []Purchase
+		var err error
+		next, err = s.OrderBy("Customer").After(next).FindPage(&page, 1)
+		if err != nil || len(page) != 1 {
+			t.Fatal("failed to query page", i, page, err)
+		}
+		ids = append(ids, page[0].ID)
+		if next == "" {
+			break
+		}
+	}
+	if len(ids) != 4 || ids[0] != 4 || ids[1] != 3 || ids[2] != 1 || ids[3] != 2 || next != "" {
+		t.Fatal("failed to page through ties, got", ids)
+	}
+
+	var page []Purchase
+	first, _ := s.OrderBy("Customer").FindPage(&page, 1)
+	if _, err := s.OrderBy("Total").After(first).FindPage(&page, 1); err == nil {
+		t.Fatal("expect error for cursor of another order")
+	}
+}
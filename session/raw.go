@@ -1,8 +1,10 @@
 package session
 
 import (
+	"context"
 	"database/sql"
 	"strings"
+	"time"
 
 	"orm/clause"
 	"orm/dialect"
@@ -11,28 +13,98 @@ import (
 )
 
 type CommonDB interface {
-	Query(query string, args ...interface{}) (*sql.Rows, error)
-	QueryRow(query string, args ...interface{}) *sql.Row
-	Exec(query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// TxBeginner is what a session runs on, a *sql.DB or a *sql.Conn pinning
+// the statements to one connection.
+type TxBeginner interface {
+	CommonDB
+	BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error)
 }
 
 type Session struct {
-	db      *sql.DB
-	tx      *sql.Tx
-	sql     strings.Builder
-	sqlVars []interface{}
+	db TxBeginner
+	tx *sql.Tx
+	// savepoints of the nested transactions, innermost last
+	savepoints []string
+	// outerSavepoints is the number of savepoints opened on tx by the
+	// session this one runs the statements of, see sub
+	outerSavepoints int
+	txOptions       *sql.TxOptions
+	ctx             context.Context
+	sql             strings.Builder
+	sqlVars         []interface{}
 
 	dialect  dialect.Dialect
 	refTable *schema.Schema
+	modelErr error
+	model    interface{} // last value passed to Model, receives the hooks
 
-	clause clause.Clause
+	callbacks *Callbacks
+	clock     func() time.Time
+	op        Operation
+	value     interface{}
+	stmt      string
+	stmtVars  []interface{}
+
+	clause  clause.Clause
+	selects []string
+	orderBy string
+	after   string
+	// associations loaded by Find, see Preload
+	preloads []string
+	// Insert writes the model alone, see OmitAssociations
+	omitAssociations bool
+	// soft deleted rows are included and deleted for good, see Unscoped
+	unscoped bool
 }
 
-func New(db *sql.DB, dialect dialect.Dialect) *Session {
+func New(db TxBeginner, dialect dialect.Dialect) *Session {
 	return &Session{
 		db:      db,
+		ctx:     context.Background(),
 		dialect: dialect,
+		clause:  clause.New(dialect),
+	}
+}
+
+// WithContext makes every following statement and transaction of the
+// session run under ctx.
+func (s *Session) WithContext(ctx context.Context) *Session {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	s.ctx = ctx
+	return s
+}
+
+// WithTxOptions sets the isolation level and read-only mode of the
+// transactions the session begins, savepoints inherit the outer ones.
+func (s *Session) WithTxOptions(opts *sql.TxOptions) *Session {
+	s.txOptions = opts
+	return s
+}
+
+// WithClock makes the session read the time of the timestamp and soft
+// delete fields from now instead of time.Now, e.g. to freeze it in tests.
+func (s *Session) WithClock(now func() time.Time) *Session {
+	s.clock = now
+	return s
+}
+
+// Now returns the time of the session clock.
+func (s *Session) Now() time.Time {
+	if s.clock != nil {
+		return s.clock()
 	}
+	return time.Now()
+}
+
+func (s *Session) Context() context.Context {
+	return s.ctx
 }
 
 func (s *Session) DB() CommonDB {
@@ -45,7 +117,25 @@ func (s *Session) DB() CommonDB {
 func (s *Session) Clear() {
 	s.sql.Reset()
 	s.sqlVars = nil
-	s.clause = clause.Clause{}
+	s.clause = clause.New(s.dialect)
+	s.selects = nil
+	s.orderBy = ""
+	s.after = ""
+	s.preloads = nil
+	s.omitAssociations = false
+	s.unscoped = false
+}
+
+// clearStatement resets the session once a statement has run. A statement
+// run by a callback or hook keeps the conditions of the running operation,
+// which clears them itself when it is done.
+func (s *Session) clearStatement() {
+	if s.op != OpRaw {
+		s.sql.Reset()
+		s.sqlVars = nil
+		return
+	}
+	s.Clear()
 }
 
 func (s *Session) Raw(sql string, values ...interface{}) *Session {
@@ -56,25 +146,71 @@ func (s *Session) Raw(sql string, values ...interface{}) *Session {
 }
 
 func (s *Session) Exec() (result sql.Result, err error) {
-	defer s.Clear()
-	log.Info(s.sql.String(), s.sqlVars)
-	if result, err = s.DB().Exec(s.sql.String(), s.sqlVars...); err != nil {
+	defer s.clearStatement()
+	s.stmt, s.stmtVars = s.sql.String(), s.sqlVars
+	if err = s.beforeRaw(); err != nil {
+		return
+	}
+	log.Info(s.stmt, s.stmtVars)
+	if result, err = s.DB().ExecContext(s.ctx, s.stmt, s.stmtVars...); err != nil {
 		log.Error(err)
+		return
 	}
+	err = s.afterRaw()
 	return
 }
 
+// QueryRow runs a query expected to return at most one row. *sql.Row cannot
+// hold an error of its own: when a callback aborts the statement, the row
+// fails with context.Canceled and the error of the callback is only logged.
+// Use ScanRow or QueryRows to get it.
 func (s *Session) QueryRow() *sql.Row {
-	defer s.Clear()
-	log.Info(s.sql.String(), s.sqlVars)
-	return s.DB().QueryRow(s.sql.String(), s.sqlVars...)
+	defer s.clearStatement()
+	s.stmt, s.stmtVars = s.sql.String(), s.sqlVars
+	if err := s.beforeRaw(); err != nil {
+		return s.DB().QueryRowContext(cancelled(s.ctx), s.stmt, s.stmtVars...)
+	}
+	log.Info(s.stmt, s.stmtVars)
+	row := s.DB().QueryRowContext(s.ctx, s.stmt, s.stmtVars...)
+	_ = s.afterRaw()
+	return row
+}
+
+// ScanRow runs the query and scans its first row into dest like
+// QueryRow().Scan, sql.ErrNoRows when there is none, but returns the error of
+// a callback aborting the statement.
+func (s *Session) ScanRow(dest ...interface{}) error {
+	rows, err := s.QueryRows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		return sql.ErrNoRows
+	}
+	if err := rows.Scan(dest...); err != nil {
+		return err
+	}
+	return rows.Close()
 }
 
 func (s *Session) QueryRows() (rows *sql.Rows, err error) {
-	defer s.Clear()
-	log.Info(s.sql.String(), s.sqlVars)
-	if rows, err = s.DB().Query(s.sql.String(), s.sqlVars...); err != nil {
+	defer s.clearStatement()
+	s.stmt, s.stmtVars = s.sql.String(), s.sqlVars
+	if err = s.beforeRaw(); err != nil {
+		return
+	}
+	log.Info(s.stmt, s.stmtVars)
+	if rows, err = s.DB().QueryContext(s.ctx, s.stmt, s.stmtVars...); err != nil {
 		log.Error(err)
+		return
+	}
+	if err = s.afterRaw(); err != nil {
+		_ = rows.Close()
+		return nil, err
 	}
 	return
 }
@@ -1,7 +1,9 @@
 package session
 
 import (
+	"context"
 	"testing"
+	"time"
 
 	"orm/log"
 )
@@ -16,3 +18,28 @@ func TestSessionRawExec(t *testing.T) {
 	count, _ := result.RowsAffected()
 	log.Infof("Exec success, %d affected\n", count)
 }
+
+func TestSessionWithContext(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	s := NewSession().WithContext(ctx)
+	start := time.Now()
+	row := s.Raw(`WITH RECURSIVE c(x) AS (SELECT 1 UNION ALL SELECT x + 1 FROM c WHERE x < 1000000000)
+		SELECT max(x) FROM c`).QueryRow()
+	var max int64
+	err := row.Scan(&max)
+	if err == nil {
+		t.Fatal("expect the query to be aborted by the context")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatal("query was not aborted in time, took", elapsed)
+	}
+
+	if _, err := s.Raw("SELECT 1").Exec(); err == nil {
+		t.Fatal("expect exec with a done context to fail")
+	}
+	if err := s.Begin(); err == nil {
+		t.Fatal("expect begin with a done context to fail")
+	}
+}
@@ -1,89 +1,318 @@
 package session
 
 import (
+	"database/sql"
 	"errors"
+	"fmt"
 	"reflect"
+	"time"
 
 	"orm/clause"
+	"orm/log"
 	"orm/schema"
 )
 
 // Insert(&User{}) or Insert([]&User{})
+//
+// The associated models set in the records are inserted too, in one
+// transaction: the models they belong to first, their keys copied into the
+// records, then the records one by one so their generated keys reach the
+// models they have, see OmitAssociations. Associated models which are saved
+// already are not inserted again, a child only gets the key of its record.
 func (s *Session) Insert(val interface{}) (int64, error) {
-	recordValues := make([]interface{}, 0)
-
+	omit := s.omitAssociations
+	// the settings of an aborted operation must not leak into the next one
+	defer s.Clear()
 	reflectValue := reflect.ValueOf(val)
 	for reflectValue.Kind() == reflect.Ptr {
 		reflectValue = reflectValue.Elem()
 	}
 
-	var table *schema.Schema
-
+	var records []interface{}
 	if reflectValue.Kind() == reflect.Slice {
 		for i := 0; i < reflectValue.Len(); i++ {
-			if i == 0 {
-				table = s.Model(reflectValue.Index(i).Interface()).RefTable()
-			}
-			s.CallMethod(BeforeInsert, reflectValue.Index(i).Interface())
-			recordValues = append(recordValues, table.RecordValues(reflectValue.Index(i).Interface()))
+			records = append(records, reflectValue.Index(i).Interface())
 		}
 	} else if reflectValue.Kind() == reflect.Struct {
-		table = s.Model(val).RefTable()
-		s.CallMethod(BeforeInsert, val)
-		recordValues = append(recordValues, table.RecordValues(val))
+		records = append(records, val)
 	} else {
 		return 0, errors.New("unsupported type")
 	}
+	if len(records) == 0 {
+		return 0, errors.New("no records to insert")
+	}
 
-	s.clause.Set(clause.INSERT, table.Name, table.FieldNames)
-	s.clause.Set(clause.VALUES, recordValues...)
-	sql, vars := s.clause.Build(clause.INSERT, clause.VALUES)
-	result, err := s.Raw(sql, vars...).Exec()
+	table := s.Model(records[0]).RefTable()
+	if table == nil {
+		return 0, s.ModelError()
+	}
+	if !omit && hasAssociations(table, reflectValue) {
+		result, err := s.Transaction(func(s *Session) (interface{}, error) {
+			return s.insertAssociated(table, reflectValue)
+		})
+		n, _ := result.(int64)
+		return n, err
+	}
+	setTimestamps(table, reflectValue, records, s.Now())
+
+	leave, err := s.enter(OpCreate, val)
 	if err != nil {
 		return 0, err
 	}
+	defer leave()
 
-	if reflectValue.Kind() == reflect.Slice {
-		for i := 0; i < reflectValue.Len(); i++ {
-			s.CallMethod(AfterInsert, reflectValue.Index(i).Interface())
+	for _, record := range records {
+		if err := s.CallMethod(BeforeInsert, record); err != nil {
+			return 0, err
+		}
+	}
+
+	fields := table.InsertFields(records...)
+	columns := make([]string, 0, len(fields))
+	for _, field := range fields {
+		columns = append(columns, field.Column)
+	}
+	recordValues := make([]interface{}, 0, len(records))
+	for _, record := range records {
+		recordValues = append(recordValues, table.FieldValues(record, fields))
+	}
+
+	s.clause.Set(clause.INSERT, table.Name, columns)
+	s.clause.Set(clause.VALUES, recordValues...)
+	sql, vars := s.clause.Build(clause.INSERT, clause.VALUES)
+	var affected int64
+	if key, returning := s.generatedKey(table, reflectValue); returning != "" {
+		if err := s.Raw(sql+" "+returning, vars...).ScanRow(key); err != nil {
+			return 0, err
 		}
+		affected = 1
 	} else {
-		s.CallMethod(AfterInsert, val)
+		result, err := s.Raw(sql, vars...).Exec()
+		if err != nil {
+			return 0, err
+		}
+		if reflectValue.Kind() == reflect.Struct {
+			setAutoIncrement(table, reflectValue, result)
+		}
+		if affected, err = result.RowsAffected(); err != nil {
+			return 0, err
+		}
+	}
+
+	for _, record := range records {
+		if err := s.CallMethod(AfterInsert, record); err != nil {
+			return 0, err
+		}
+	}
+	if err := s.done(); err != nil {
+		return 0, err
+	}
+	return affected, nil
+}
+
+// setTimestamps sets the unset CreatedAt and UpdatedAt fields of the records
+// of value to now. A record passed by value is replaced by a stamped copy.
+func setTimestamps(table *schema.Schema, value reflect.Value, records []interface{}, now time.Time) {
+	if table.CreatedAt == nil && table.UpdatedAt == nil {
+		return
+	}
+	for i, record := range records {
+		v := reflect.ValueOf(record)
+		if value.Kind() == reflect.Slice {
+			v = value.Index(i)
+		}
+		if v = reflect.Indirect(v); !v.IsValid() {
+			continue
+		}
+		if !v.CanSet() {
+			stamped := reflect.New(v.Type()).Elem()
+			stamped.Set(v)
+			v = stamped
+		}
+		for _, field := range []*schema.Field{table.CreatedAt, table.UpdatedAt} {
+			if field != nil && v.FieldByName(field.Name).IsZero() {
+				setTime(v.FieldByName(field.Name), now)
+			}
+		}
+		if reflect.ValueOf(record).Kind() != reflect.Ptr {
+			records[i] = v.Interface()
+		}
+	}
+}
+
+// setTime sets the time.Time, *time.Time or sql.NullTime field to t.
+func setTime(field reflect.Value, t time.Time) {
+	switch field.Interface().(type) {
+	case *time.Time:
+		field.Set(reflect.ValueOf(&t))
+	case sql.NullTime:
+		field.Set(reflect.ValueOf(sql.NullTime{Time: t, Valid: true}))
+	default:
+		field.Set(reflect.ValueOf(t))
+	}
+}
+
+// autoIncrementField returns the auto increment field of the single record
+// dest when its key is left to the database, or an invalid Value.
+func autoIncrementField(table *schema.Schema, dest reflect.Value) (*schema.Field, reflect.Value) {
+	auto := table.AutoIncrementField()
+	if auto == nil || dest.Kind() != reflect.Struct {
+		return nil, reflect.Value{}
+	}
+	field := dest.FieldByName(auto.Name)
+	if !field.CanSet() || !field.IsZero() {
+		return nil, reflect.Value{}
+	}
+	return auto, field
+}
+
+// generatedKey returns where to scan the generated key of the single record
+// dest and the clause returning it, or "" when the dialect reads it from the
+// result of the statement.
+func (s *Session) generatedKey(table *schema.Schema, dest reflect.Value) (interface{}, string) {
+	auto, field := autoIncrementField(table, dest)
+	if auto == nil {
+		return nil, ""
+	}
+	return field.Addr().Interface(), s.dialect.Returning(auto.Column)
+}
+
+// setAutoIncrement back-fills the generated key of a single inserted record.
+// The row is written already, so a driver which cannot report the key only
+// leaves it unset.
+func setAutoIncrement(table *schema.Schema, dest reflect.Value, result sql.Result) {
+	auto, field := autoIncrementField(table, dest)
+	if auto == nil {
+		return
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		log.Errorf("insert %s: cannot read the generated %s: %v", table.Name, auto.Name, err)
+		return
+	}
+	switch field.Kind() {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		field.SetUint(uint64(id))
+	default:
+		field.SetInt(id)
 	}
-	return result.RowsAffected()
 }
 
 func (s *Session) Find(vals interface{}) error {
+	defer s.Clear()
 	destSlice := reflect.Indirect(reflect.ValueOf(vals))
 	destType := destSlice.Type().Elem()
-	table := s.Model(reflect.New(destType).Elem().Interface()).RefTable()
+	start, preloads := destSlice.Len(), s.preloads
+
+	var table *schema.Schema
+	var selects []string
+	// labels of the result columns of a composite struct, nil for a model
+	var targets map[string]*columnTarget
+	if s.clause.Has(clause.JOIN) && s.isComposite(destType) {
+		// the joined models are nested in the result, Model is the main table
+		if table = s.RefTable(); table == nil {
+			return s.ModelError()
+		}
+		var err error
+		if targets, selects, err = s.compositeColumns(destType); err != nil {
+			return err
+		}
+	} else {
+		if table = s.Model(reflect.New(destType).Interface()).RefTable(); table == nil {
+			return s.ModelError()
+		}
+		selects = table.FieldNames
+		if s.clause.Has(clause.JOIN) {
+			// joined tables may have columns with the same names
+			selects = make([]string, 0, len(table.FieldNames))
+			for _, name := range table.FieldNames {
+				selects = append(selects, table.Name+"."+name)
+			}
+		}
+	}
 
-	s.CallMethod(BeforeQuery, reflect.New(destType).Elem().Addr().Interface())
+	leave, err := s.enter(OpQuery, vals)
+	if err != nil {
+		return err
+	}
+	defer leave()
+
+	if err := s.CallMethod(BeforeQuery, reflect.New(destType).Elem().Addr().Interface()); err != nil {
+		return err
+	}
 
-	s.clause.Set(clause.SELECT, table.Name, table.FieldNames)
-	sql, vars := s.clause.Build(clause.SELECT, clause.WHERE, clause.ORDERBY, clause.LIMIT)
+	if len(s.selects) > 0 {
+		selects = s.selects
+	}
+	s.notDeleted(table)
+	s.clause.Set(clause.SELECT, table.Name, selects)
+	sql, vars := s.clause.Build(clause.SELECT, clause.JOIN, clause.WHERE, clause.GROUPBY, clause.HAVING, clause.ORDERBY, clause.LIMIT, clause.OFFSET)
 	rows, err := s.Raw(sql, vars...).QueryRows()
 	if err != nil {
 		return err
 	}
+	defer rows.Close()
+
+	// scan by column name, Select may pick any subset or alias of the fields
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	columnTargets := make([]*columnTarget, 0, len(columns))
+	for _, column := range columns {
+		var target *columnTarget
+		if targets != nil {
+			target = targets[column]
+		} else if field := table.GetField(column); field != nil {
+			f, _ := destType.FieldByName(field.Name)
+			target = &columnTarget{index: f.Index, typ: f.Type}
+		}
+		if target == nil {
+			return fmt.Errorf("column %s has no field in %s", column, destType.Name())
+		}
+		columnTargets = append(columnTargets, target)
+	}
 
 	for rows.Next() {
 		dest := reflect.New(destType).Elem()
-		var values []interface{}
-		for _, name := range table.FieldNames {
-			values = append(values, dest.FieldByName(name).Addr().Interface())
+		values := make([]interface{}, len(columnTargets))
+		for i, target := range columnTargets {
+			values[i] = target.value(dest)
 		}
 		if err := rows.Scan(values...); err != nil {
 			return err
 		}
+		for i, target := range columnTargets {
+			target.assign(dest, values[i])
+		}
 
-		s.CallMethod(AfterQuery, dest.Addr().Interface())
+		if err := s.CallMethod(AfterQuery, dest.Addr().Interface()); err != nil {
+			return err
+		}
 		destSlice.Set(reflect.Append(destSlice, dest))
 	}
-	return rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if err := rows.Close(); err != nil {
+		return err
+	}
+	if len(preloads) > 0 {
+		if targets != nil {
+			return fmt.Errorf("cannot preload associations into %s, the result of a join", destType.Name())
+		}
+		if err := s.preload(table, destSlice.Slice(start, destSlice.Len()), preloads); err != nil {
+			return err
+		}
+	}
+	return s.done()
 }
 
+// Update sets the columns of kv, a map or column and value pairs, in the
+// matching rows. The UpdatedAt column is set to the session time unless kv
+// sets it.
 func (s *Session) Update(kv ...interface{}) (int64, error) {
+	defer s.Clear()
 	m, ok := kv[0].(map[string]interface{})
 	if !ok {
 		m = make(map[string]interface{})
@@ -99,45 +328,168 @@ func (s *Session) Update(kv ...interface{}) (int64, error) {
 	if table == nil || table.Name == "" {
 		return 0, errors.New("no set model")
 	}
+	if field := table.UpdatedAt; field != nil {
+		if _, ok := m[field.Column]; !ok {
+			// copied, the map may be the caller's
+			stamped := map[string]interface{}{field.Column: s.Now()}
+			for k, v := range m {
+				stamped[k] = v
+			}
+			m = stamped
+		}
+	}
 
+	leave, err := s.enter(OpUpdate, s.model)
+	if err != nil {
+		return 0, err
+	}
+	defer leave()
+
+	// built before the hook, the statements it runs on s clear the conditions
+	s.notDeleted(table)
 	s.clause.Set(clause.UPDATE, table.Name, m)
 	sql, vars := s.clause.Build(clause.UPDATE, clause.WHERE)
+	if err := s.CallMethod(BeforeUpdate, s.model); err != nil {
+		return 0, err
+	}
 	result, err := s.Raw(sql, vars...).Exec()
 	if err != nil {
 		return 0, err
 	}
+	if err := s.CallMethod(AfterUpdate, s.model); err != nil {
+		return 0, err
+	}
+	if err := s.done(); err != nil {
+		return 0, err
+	}
 	return result.RowsAffected()
 }
 
+// Delete deletes the matching rows. The rows of a model with a soft delete
+// field are marked deleted instead, see Unscoped and HardDelete.
 func (s *Session) Delete() (int64, error) {
+	defer s.Clear()
 	table := s.RefTable()
 	if table == nil || table.Name == "" {
 		return 0, errors.New("no set model")
 	}
 
-	s.clause.Set(clause.DELETE, table.Name)
-	sql, vars := s.clause.Build(clause.DELETE, clause.WHERE)
+	leave, err := s.enter(OpDelete, s.model)
+	if err != nil {
+		return 0, err
+	}
+	defer leave()
+
+	// built before the hook, the statements it runs on s clear the conditions
+	var sql string
+	var vars []interface{}
+	if table.DeletedAt != nil && !s.unscoped {
+		// a soft delete marks the rows which are not deleted yet
+		s.notDeleted(table)
+		s.clause.Set(clause.UPDATE, table.Name, map[string]interface{}{table.DeletedAt.Column: s.Now()})
+		sql, vars = s.clause.Build(clause.UPDATE, clause.WHERE)
+	} else {
+		s.clause.Set(clause.DELETE, table.Name)
+		sql, vars = s.clause.Build(clause.DELETE, clause.WHERE)
+	}
+	if err := s.CallMethod(BeforeDelete, s.model); err != nil {
+		return 0, err
+	}
 	result, err := s.Raw(sql, vars...).Exec()
 	if err != nil {
 		return 0, err
 	}
+	if err := s.CallMethod(AfterDelete, s.model); err != nil {
+		return 0, err
+	}
+	if err := s.done(); err != nil {
+		return 0, err
+	}
 	return result.RowsAffected()
 }
 
 func (s *Session) Count() (int64, error) {
+	defer s.Clear()
 	table := s.RefTable()
 	if table == nil || table.Name == "" {
 		return 0, errors.New("no set model")
 	}
 
+	leave, err := s.enter(OpQuery, s.model)
+	if err != nil {
+		return 0, err
+	}
+	defer leave()
+
+	s.notDeleted(table)
 	s.clause.Set(clause.COUNT, table.Name)
-	sql, vars := s.clause.Build(clause.COUNT, clause.WHERE)
-	row := s.Raw(sql, vars...).QueryRow()
+	sql, vars := s.clause.Build(clause.COUNT, clause.JOIN, clause.WHERE)
 	var tmp int64
-	if err := row.Scan(&tmp); err != nil {
+	if err := s.Raw(sql, vars...).ScanRow(&tmp); err != nil {
+		return 0, err
+	}
+	return tmp, s.done()
+}
+
+// aggregate returns fn(column) over the rows matching the conditions,
+// 0 when there is no such row.
+func (s *Session) aggregate(fn, column string) (float64, error) {
+	defer s.Clear()
+	table := s.RefTable()
+	if table == nil || table.Name == "" {
+		return 0, errors.New("no set model")
+	}
+
+	leave, err := s.enter(OpQuery, s.model)
+	if err != nil {
+		return 0, err
+	}
+	defer leave()
+
+	s.notDeleted(table)
+	s.clause.Set(clause.SELECT, table.Name, []string{fmt.Sprintf("%s(%s)", fn, s.clause.Quote(column))})
+	query, vars := s.clause.Build(clause.SELECT, clause.JOIN, clause.WHERE)
+	var tmp sql.NullFloat64
+	if err := s.Raw(query, vars...).ScanRow(&tmp); err != nil {
 		return 0, err
 	}
-	return tmp, nil
+	return tmp.Float64, s.done()
+}
+
+func (s *Session) Sum(column string) (float64, error) {
+	return s.aggregate("SUM", column)
+}
+
+func (s *Session) Avg(column string) (float64, error) {
+	return s.aggregate("AVG", column)
+}
+
+func (s *Session) Min(column string) (float64, error) {
+	return s.aggregate("MIN", column)
+}
+
+func (s *Session) Max(column string) (float64, error) {
+	return s.aggregate("MAX", column)
+}
+
+// Select sets the columns queried by Find and First, expressions need an
+// alias matching a column of the model:
+//
+//	s.Select("Customer", "SUM(Total) AS Total").Group("Customer").Find(&orders)
+func (s *Session) Select(columns ...string) *Session {
+	s.selects = columns
+	return s
+}
+
+func (s *Session) Group(columns ...string) *Session {
+	s.clause.Set(clause.GROUPBY, columns)
+	return s
+}
+
+// Having adds a condition on the groups with AND, like Where.
+func (s *Session) Having(query interface{}, args ...interface{}) *Session {
+	s.clause.AndHaving(condition(query, args...))
+	return s
 }
 
 func (s *Session) Limit(num int) *Session {
@@ -145,14 +497,45 @@ func (s *Session) Limit(num int) *Session {
 	return s
 }
 
-func (s *Session) Where(desc string, args ...interface{}) *Session {
-	var vars []interface{}
-	s.clause.Set(clause.WHERE, append(append(vars, desc), args...)...)
+// Offset skips num records, most databases only accept it with Limit.
+func (s *Session) Offset(num int) *Session {
+	s.clause.Set(clause.OFFSET, num)
+	return s
+}
+
+// condition turns the arguments of Where, Or and Not into a clause.Condition,
+// query is either a SQL expression with args or a clause.Condition.
+func condition(query interface{}, args ...interface{}) clause.Condition {
+	if cond, ok := query.(clause.Condition); ok {
+		return cond
+	}
+	return clause.Expr(fmt.Sprint(query), args...)
+}
+
+// Where adds a condition with AND, s.Where("Age > ?", 18).Where("Name = ?", "Tom").
+// Grouped conditions are built with the clause package:
+//
+//	s.Where(clause.Or(clause.Expr("Age < ?", 18), clause.Expr("Age > ?", 60)))
+func (s *Session) Where(query interface{}, args ...interface{}) *Session {
+	s.clause.AndWhere(condition(query, args...))
+	return s
+}
+
+// Or adds a condition with OR, the conditions before it are grouped together.
+func (s *Session) Or(query interface{}, args ...interface{}) *Session {
+	s.clause.OrWhere(condition(query, args...))
+	return s
+}
+
+// Not adds a negated condition with AND.
+func (s *Session) Not(query interface{}, args ...interface{}) *Session {
+	s.clause.AndWhere(clause.Not(condition(query, args...)))
 	return s
 }
 
 func (s *Session) OrderBy(desc string) *Session {
 	s.clause.Set(clause.ORDERBY, desc)
+	s.orderBy = desc
 	return s
 }
 
@@ -168,3 +551,71 @@ func (s *Session) First(value interface{}) error {
 	dest.Set(destSlice.Index(0))
 	return nil
 }
+
+// primaryKeyTable returns the schema of value and makes sure it has a primary key.
+func (s *Session) primaryKeyTable(value interface{}) (*schema.Schema, error) {
+	table := s.Model(value).RefTable()
+	if table == nil {
+		return nil, s.ModelError()
+	}
+	if len(table.PrimaryKeys) == 0 {
+		return nil, fmt.Errorf("model %s has no primary key", table.Name)
+	}
+	return table, nil
+}
+
+// Save inserts value when its primary key is unset, otherwise it updates
+// every other column of the record with the same primary key. An unset
+// CreatedAt keeps the create time of the record.
+func (s *Session) Save(value interface{}) (int64, error) {
+	table, err := s.primaryKeyTable(value)
+	if err != nil {
+		return 0, err
+	}
+	if table.IsPrimaryKeyZero(value) {
+		return s.Insert(value)
+	}
+
+	m := make(map[string]interface{})
+	destValue := reflect.Indirect(reflect.ValueOf(value))
+	for _, field := range table.Fields {
+		v := destValue.FieldByName(field.Name)
+		if field.PrimaryKey || field == table.CreatedAt && v.IsZero() {
+			continue
+		}
+		m[field.Column] = v.Interface()
+	}
+	if field := table.UpdatedAt; field != nil {
+		now := s.Now()
+		m[field.Column] = now
+		if destValue.CanSet() {
+			setTime(destValue.FieldByName(field.Name), now)
+		}
+	}
+	if len(m) == 0 {
+		return 0, nil
+	}
+	return s.Where(table.PrimaryKeyCondition(), table.PrimaryKeyValues(value)...).Update(m)
+}
+
+// DeleteModel deletes the record with the primary key of value.
+func (s *Session) DeleteModel(value interface{}) (int64, error) {
+	table, err := s.primaryKeyTable(value)
+	if err != nil {
+		return 0, err
+	}
+	return s.Where(table.PrimaryKeyCondition(), table.PrimaryKeyValues(value)...).Delete()
+}
+
+// Get loads the record whose primary key equals ids into value, ids are given
+// in field order for a composite key.
+func (s *Session) Get(value interface{}, ids ...interface{}) error {
+	table, err := s.primaryKeyTable(value)
+	if err != nil {
+		return err
+	}
+	if len(ids) != len(table.PrimaryKeys) {
+		return fmt.Errorf("model %s expects %d primary key values, got %d", table.Name, len(table.PrimaryKeys), len(ids))
+	}
+	return s.Where(table.PrimaryKeyCondition(), ids...).First(value)
+}
@@ -1,6 +1,12 @@
 package session
 
-import "testing"
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"orm/clause"
+)
 
 var (
 	user1 = &User{"Tom", 18}
@@ -66,3 +72,207 @@ func TestSession_DeleteAndCount(t *testing.T) {
 		t.Fatal("failed to delete or count")
 	}
 }
+
+func testBookInit(t *testing.T) *Session {
+	t.Helper()
+	s := NewSession().Model(&Book{})
+	err1 := s.DropTable()
+	err2 := s.CreateTable()
+	_, err3 := s.Insert([]*Book{{Title: "Go", Author: "Rob"}, {Title: "C", Author: "Dennis"}})
+	if err1 != nil || err2 != nil || err3 != nil {
+		t.Fatal("failed init test books")
+	}
+	return s
+}
+
+func TestSession_InsertAutoIncrement(t *testing.T) {
+	s := testBookInit(t)
+	book := &Book{Title: "Rust"}
+	if _, err := s.Insert(book); err != nil || book.ID != 3 {
+		t.Fatal("failed to back-fill auto increment id, got", book.ID, err)
+	}
+}
+
+func TestSession_Get(t *testing.T) {
+	s := testBookInit(t)
+	book := &Book{}
+	if err := s.Get(book, 2); err != nil || book.Title != "C" {
+		t.Fatal("failed to get by primary key", book, err)
+	}
+	if err := s.Get(book, 1, 2); err == nil {
+		t.Fatal("expect error for wrong number of keys")
+	}
+}
+
+func TestSession_Save(t *testing.T) {
+	s := testBookInit(t)
+	book := &Book{}
+	_ = s.Get(book, 1)
+	book.Title = "The Go Programming Language"
+	if affected, err := s.Save(book); err != nil || affected != 1 {
+		t.Fatal("failed to save existing book", err)
+	}
+
+	saved := &Book{}
+	if err := s.Get(saved, 1); err != nil || saved.Title != book.Title {
+		t.Fatal("failed to update by primary key", saved)
+	}
+
+	book = &Book{Title: "Python"}
+	if _, err := s.Save(book); err != nil || book.ID != 3 {
+		t.Fatal("failed to save new book", book, err)
+	}
+}
+
+func TestSession_DeleteModel(t *testing.T) {
+	s := testBookInit(t)
+	affected, err := s.DeleteModel(&Book{ID: 1})
+	count, _ := s.Count()
+	if err != nil || affected != 1 || count != 1 {
+		t.Fatal("failed to delete by primary key")
+	}
+
+	if _, err := s.Model(&Account{}).DeleteModel(&Account{ID: 1}); err == nil {
+		t.Fatal("expect error for model without primary key")
+	}
+}
+
+func TestSession_WhereChain(t *testing.T) {
+	s := testRecordInit(t)
+	_, _ = s.Insert(user3)
+
+	var users []User
+	if err := s.Where("Age = ?", 25).Where("Name = ?", "Sam").Find(&users); err != nil || len(users) != 1 {
+		t.Fatal("failed to AND conditions", users)
+	}
+
+	users = nil
+	if err := s.Where("Name = ?", "Tom").Or("Name = ?", "Jack").OrderBy("Name").Find(&users); err != nil ||
+		len(users) != 2 || users[0].Name != "Jack" {
+		t.Fatal("failed to OR conditions", users)
+	}
+
+	users = nil
+	if err := s.Not("Name = ?", "Tom").Where(clause.Or(clause.Expr("Age < ?", 20), clause.Expr("Name = ?", "Sam"))).
+		Find(&users); err != nil || len(users) != 1 || users[0].Name != "Sam" {
+		t.Fatal("failed to group conditions", users)
+	}
+}
+
+type Purchase struct {
+	ID       int `orm:"primary key"`
+	Customer string
+	Total    float64
+}
+
+func testPurchaseInit(t *testing.T) *Session {
+	t.Helper()
+	s := NewSession().Model(&Purchase{})
+	err1 := s.DropTable()
+	err2 := s.CreateTable()
+	_, err3 := s.Insert([]*Purchase{
+		{1, "Tom", 80}, {2, "Tom", 40}, {3, "Sam", 60}, {4, "Jack", 150},
+	})
+	if err1 != nil || err2 != nil || err3 != nil {
+		t.Fatal("failed init test purchases")
+	}
+	return s
+}
+
+func TestSession_GroupHaving(t *testing.T) {
+	s := testPurchaseInit(t)
+	var totals []Purchase
+	err := s.Select("Customer", "SUM(Total) AS Total").Group("Customer").
+		Having("SUM(Total) > ?", 100).OrderBy("Customer").Find(&totals)
+	if err != nil || len(totals) != 2 {
+		t.Fatal("failed to group purchases", totals, err)
+	}
+	if totals[0].Customer != "Jack" || totals[0].Total != 150 || totals[1].Customer != "Tom" || totals[1].Total != 120 {
+		t.Fatal("failed to sum purchases per customer", totals)
+	}
+
+	var customers []Purchase
+	if err := s.Select("Customer").Where("Total > ?", 50).Find(&customers); err != nil || len(customers) != 3 {
+		t.Fatal("failed to select columns", customers, err)
+	}
+	if err := s.Select("SUM(Total)").Find(&customers); err == nil {
+		t.Fatal("expect error for column without field")
+	}
+}
+
+func TestSession_Aggregate(t *testing.T) {
+	s := testPurchaseInit(t)
+	sum, err1 := s.Sum("Total")
+	avg, err2 := s.Where("Customer = ?", "Tom").Avg("Total")
+	min, err3 := s.Min("Total")
+	max, err4 := s.Max("Total")
+	if err1 != nil || err2 != nil || err3 != nil || err4 != nil {
+		t.Fatal("failed to aggregate", err1, err2, err3, err4)
+	}
+	if sum != 330 || avg != 60 || min != 40 || max != 150 {
+		t.Fatal("wrong aggregates", sum, avg, min, max)
+	}
+
+	if sum, err := s.Where("Customer = ?", "Nobody").Sum("Total"); err != nil || sum != 0 {
+		t.Fatal("expect 0 without rows", sum, err)
+	}
+}
+
+type Post struct {
+	ID        int `orm:"primary key"`
+	Title     string
+	CreatedAt time.Time
+	UpdatedAt sql.NullTime
+}
+
+func TestSession_Timestamps(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	s := NewSession().WithClock(func() time.Time { return now }).Model(&Post{})
+	_ = s.DropTable()
+	_ = s.CreateTable()
+
+	created := now.Add(-time.Hour)
+	posts := []Post{{ID: 1, Title: "a"}, {ID: 2, Title: "b", CreatedAt: created}}
+	if _, err := s.Insert(posts); err != nil {
+		t.Fatal(err)
+	}
+	if !posts[0].CreatedAt.Equal(now) || !posts[0].UpdatedAt.Time.Equal(now) || !posts[1].CreatedAt.Equal(created) {
+		t.Fatal("failed to set the unset timestamps, got", posts)
+	}
+	// a record passed by value is stamped too
+	if _, err := s.Insert(Post{ID: 3}); err != nil {
+		t.Fatal(err)
+	}
+	var post Post
+	if err := s.Get(&post, 3); err != nil || !post.CreatedAt.Equal(now) {
+		t.Fatal("failed to stamp a record passed by value, got", post, err)
+	}
+
+	now = now.Add(time.Minute)
+	if _, err := s.Model(&Post{}).Where("ID = ?", 1).Update("Title", "z"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Get(&post, 1); err != nil || !post.UpdatedAt.Time.Equal(now) || !post.CreatedAt.Equal(now.Add(-time.Minute)) {
+		t.Fatal("failed to set UpdatedAt on update, got", post, err)
+	}
+
+	now = now.Add(time.Minute)
+	if _, err := s.Save(&post); err != nil || !post.UpdatedAt.Time.Equal(now) {
+		t.Fatal("failed to set UpdatedAt on save, got", post, err)
+	}
+	set := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	if _, err := s.Model(&Post{}).Where("ID = ?", 1).Update(map[string]interface{}{"UpdatedAt": set}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Get(&post, 1); err != nil || !post.UpdatedAt.Time.Equal(set) {
+		t.Fatal("expect an UpdatedAt given to Update to be kept, got", post, err)
+	}
+
+	// a record saved without its create time keeps the stored one
+	if _, err := s.Save(&Post{ID: 2, Title: "c"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Get(&post, 2); err != nil || post.Title != "c" || !post.CreatedAt.Equal(created) {
+		t.Fatal("expect Save to keep CreatedAt, got", post, err)
+	}
+}
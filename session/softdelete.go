@@ -0,0 +1,31 @@
+package session
+
+import (
+	"orm/clause"
+	"orm/schema"
+)
+
+// Unscoped makes the next statement include the soft deleted rows, and
+// makes Delete remove the rows for good.
+func (s *Session) Unscoped() *Session {
+	s.unscoped = true
+	return s
+}
+
+// HardDelete deletes the matching rows for good, soft deleted or not.
+func (s *Session) HardDelete() (int64, error) {
+	return s.Unscoped().Delete()
+}
+
+// notDeleted leaves the soft deleted rows of table out of the statement,
+// unless the session is unscoped.
+func (s *Session) notDeleted(table *schema.Schema) {
+	if table.DeletedAt == nil || s.unscoped {
+		return
+	}
+	column := table.DeletedAt.Column
+	if s.clause.Has(clause.JOIN) {
+		column = table.Name + "." + column
+	}
+	s.clause.AndWhere(clause.Expr(s.clause.Quote(column) + " IS NULL"))
+}
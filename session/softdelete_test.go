@@ -0,0 +1,89 @@
+package session
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+)
+
+type Note struct {
+	ID        int `orm:"primary key"`
+	Text      string
+	DeletedAt *time.Time
+}
+
+type Memo struct {
+	ID      int          `orm:"primary key"`
+	Removed sql.NullTime `orm:"column:removed_at;soft delete"`
+}
+
+func testSoftDeleteInit(t *testing.T) *Session {
+	t.Helper()
+	s := NewSession().Model(&Note{})
+	err1 := s.DropTable()
+	err2 := s.CreateTable()
+	_, err3 := s.Insert([]*Note{{ID: 1, Text: "a"}, {ID: 2, Text: "b"}, {ID: 3, Text: "c"}})
+	if err1 != nil || err2 != nil || err3 != nil {
+		t.Fatal("failed init soft delete records", err1, err2, err3)
+	}
+	return s
+}
+
+func TestSession_SoftDelete(t *testing.T) {
+	s := testSoftDeleteInit(t)
+
+	if n, err := s.DeleteModel(&Note{ID: 1}); err != nil || n != 1 {
+		t.Fatal("failed to soft delete", n, err)
+	}
+	if n, _ := s.Model(&Note{}).Where("ID = ?", 1).Delete(); n != 0 {
+		t.Fatal("expect a deleted note not to be deleted again, got", n)
+	}
+
+	var notes []Note
+	if err := s.OrderBy("ID").Find(&notes); err != nil || len(notes) != 2 || notes[0].ID != 2 {
+		t.Fatal("expect the deleted note to be left out, got", notes, err)
+	}
+	if err := s.Get(&Note{}, 1); err == nil {
+		t.Fatal("expect First not to find the deleted note")
+	}
+	if n, _ := s.Model(&Note{}).Count(); n != 2 {
+		t.Fatal("expect Count to leave the deleted note out, got", n)
+	}
+	if n, _ := s.Model(&Note{}).Update("Text", "z"); n != 2 {
+		t.Fatal("expect Update to leave the deleted note out, got", n)
+	}
+
+	var note Note
+	if err := s.Unscoped().Get(&note, 1); err != nil || note.DeletedAt == nil || note.Text != "a" {
+		t.Fatal("failed to find the deleted note unscoped", note, err)
+	}
+	if n, _ := s.Model(&Note{}).Unscoped().Count(); n != 3 {
+		t.Fatal("expect 3 notes unscoped, got", n)
+	}
+
+	if n, err := s.Model(&Note{}).Where("ID IN (?, ?)", 1, 2).HardDelete(); err != nil || n != 2 {
+		t.Fatal("failed to hard delete", n, err)
+	}
+	if n, _ := s.Model(&Note{}).Unscoped().Count(); n != 1 {
+		t.Fatal("expect 1 note left, got", n)
+	}
+}
+
+func TestSession_SoftDeleteTag(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	s := NewSession().WithClock(func() time.Time { return now }).Model(&Memo{})
+	_ = s.DropTable()
+	_ = s.CreateTable()
+	_, _ = s.Insert([]*Memo{{ID: 1}, {ID: 2}})
+
+	if _, err := s.DeleteModel(&Memo{ID: 2}); err != nil {
+		t.Fatal(err)
+	}
+	var memos []Memo
+	if err := s.Unscoped().OrderBy("ID").Find(&memos); err != nil || len(memos) != 2 {
+		t.Fatal("failed to find the memos unscoped", err)
+	}
+	if memos[0].Removed.Valid || !memos[1].Removed.Time.Equal(now) {
+		t.Fatal("failed to set removed_at, got", memos)
+	}
+}
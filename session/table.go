@@ -1,6 +1,7 @@
 package session
 
 import (
+	"database/sql"
 	"errors"
 	"fmt"
 	"reflect"
@@ -11,43 +12,231 @@ import (
 )
 
 func (s *Session) Model(value interface{}) *Session {
+	s.model = value
 	if s.refTable == nil || reflect.TypeOf(value) != reflect.TypeOf(s.refTable.Model) {
-		s.refTable = schema.Parse(value, s.dialect)
+		if s.refTable, s.modelErr = schema.Parse(value, s.dialect); s.modelErr != nil {
+			log.Error(s.modelErr)
+		}
 	}
 	return s
 }
 
+// ModelError reports why RefTable is nil.
+func (s *Session) ModelError() error {
+	if s.modelErr != nil {
+		return s.modelErr
+	}
+	return errors.New("model is not set")
+}
+
 func (s *Session) RefTable() *schema.Schema {
-	if s.refTable == nil {
+	if s.refTable == nil && s.modelErr == nil {
 		log.Error("model is not set")
 	}
 	return s.refTable
 }
 
+// CreateTable creates the table of the model and its indexes, and the join
+// tables of its many-to-many associations which do not exist yet. A join
+// table references both sides, so it is left out while the other table does
+// not exist: it is created by CreateTable of the other model if that one
+// declares the association too, or by Engine.Migrate.
 func (s *Session) CreateTable() error {
+	stmts, err := s.CreateTableSQL()
+	if err != nil {
+		return err
+	}
+	joins, err := s.JoinTables()
+	if err != nil {
+		return err
+	}
+	for _, join := range joins {
+		if missing := s.missingReference(join); missing != "" {
+			log.Infof("Join table %s skipped, table %s doesn't exist", join.Name, missing)
+			continue
+		}
+		desc := strings.Join(join.ColumnDefinitions(), ",")
+		stmts = append(stmts, fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (%s);", s.dialect.Quote(join.Name), desc))
+	}
+	for _, sql := range stmts {
+		if _, err = s.Raw(sql).Exec(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// missingReference returns a table other than the one of the model which the
+// foreign keys of join reference and which does not exist, or "".
+func (s *Session) missingReference(join *schema.Schema) string {
+	for _, fk := range join.ForeignKeys {
+		if fk.RefTable != s.refTable.Name && !s.tableExists(fk.RefTable) {
+			return fk.RefTable
+		}
+	}
+	return ""
+}
+
+// CreateTableSQL returns the statements creating the table of the model,
+// CREATE TABLE followed by CREATE INDEX for each index.
+func (s *Session) CreateTableSQL() ([]string, error) {
 	table := s.RefTable()
 	if table == nil {
-		return errors.New("model is not set")
+		return nil, s.ModelError()
 	}
-	var columns []string
-	for _, field := range table.Fields {
-		columns = append(columns, fmt.Sprintf("%s %s %s", field.Name, field.Type, field.Tag))
+	desc := strings.Join(table.ColumnDefinitions(), ",")
+	stmts := []string{fmt.Sprintf("CREATE TABLE %s (%s);", s.dialect.Quote(table.Name), desc)}
+	for _, index := range table.Indexes {
+		stmts = append(stmts, index.Definition())
 	}
-	desc := strings.Join(columns, ",")
-	_, err := s.Raw(fmt.Sprintf("CREATE TABLE %s (%s);", table.Name, desc)).Exec()
-	return err
+	return stmts, nil
+}
+
+// JoinTables returns the join tables of the many-to-many associations of the
+// model.
+func (s *Session) JoinTables() ([]*schema.Schema, error) {
+	table := s.RefTable()
+	if table == nil {
+		return nil, s.ModelError()
+	}
+	var joins []*schema.Schema
+	for _, rel := range table.Relationships {
+		if rel.Kind != schema.ManyToMany {
+			continue
+		}
+		join, err := table.JoinTable(rel, s.dialect)
+		if err != nil {
+			return nil, err
+		}
+		joins = append(joins, join)
+	}
+	return joins, nil
 }
 
 func (s *Session) DropTable() error {
 	table := s.RefTable()
 	if table == nil {
-		return errors.New("model is not set")
+		return s.ModelError()
 	}
 
-	_, err := s.Raw(fmt.Sprintf("DROP TABLE IF EXISTS %s;", table.Name)).Exec()
+	_, err := s.Raw(fmt.Sprintf("DROP TABLE IF EXISTS %s;", s.dialect.Quote(table.Name))).Exec()
 	return err
 }
 
+// Column is a column of an existing table, as reported by the database.
+type Column struct {
+	Name          string
+	Type          string
+	NotNull       bool
+	Default       sql.NullString
+	PrimaryKey    bool
+	Unique        bool
+	AutoIncrement bool
+}
+
+// Columns returns the columns the table of the model has in the database.
+func (s *Session) Columns() ([]Column, error) {
+	table := s.RefTable()
+	if table == nil {
+		return nil, s.ModelError()
+	}
+
+	query, values := s.dialect.ColumnsSQL(table.Name)
+	rows, err := s.Raw(query, values...).QueryRows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var columns []Column
+	for rows.Next() {
+		var c Column
+		if err := rows.Scan(&c.Name, &c.Type, &c.NotNull, &c.Default, &c.PrimaryKey, &c.Unique, &c.AutoIncrement); err != nil {
+			return nil, err
+		}
+		columns = append(columns, c)
+	}
+	return columns, rows.Err()
+}
+
+// Indexes returns the definitions of the indexes the table of the model has
+// in the database by name, see dialect.Dialect.IndexesSQL.
+func (s *Session) Indexes() (map[string]string, error) {
+	table := s.RefTable()
+	if table == nil {
+		return nil, s.ModelError()
+	}
+
+	query, values := s.dialect.IndexesSQL(table.Name)
+	rows, err := s.Raw(query, values...).QueryRows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	indexes := make(map[string]string)
+	for rows.Next() {
+		var name, definition string
+		if err := rows.Scan(&name, &definition); err != nil {
+			return nil, err
+		}
+		indexes[name] = definition
+	}
+	return indexes, rows.Err()
+}
+
+// ForeignKeys returns the foreign keys the table of the model has in the
+// database.
+func (s *Session) ForeignKeys() ([]*schema.ForeignKey, error) {
+	table := s.RefTable()
+	if table == nil {
+		return nil, s.ModelError()
+	}
+
+	query, values := s.dialect.ForeignKeysSQL(table.Name)
+	rows, err := s.Raw(query, values...).QueryRows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var fks []*schema.ForeignKey
+	for rows.Next() {
+		fk := &schema.ForeignKey{}
+		if err := rows.Scan(&fk.Column, &fk.RefTable, &fk.RefColumn, &fk.OnDelete, &fk.OnUpdate); err != nil {
+			return nil, err
+		}
+		fks = append(fks, fk)
+	}
+	return fks, rows.Err()
+}
+
+// ReferencingTables returns the names of the other tables whose foreign keys
+// reference the table of the model.
+func (s *Session) ReferencingTables() ([]string, error) {
+	table := s.RefTable()
+	if table == nil {
+		return nil, s.ModelError()
+	}
+
+	query, values := s.dialect.ReferencingTablesSQL(table.Name)
+	rows, err := s.Raw(query, values...).QueryRows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
+
 func (s *Session) HasTable() bool {
 	table := s.RefTable()
 	if table == nil {
@@ -55,9 +244,12 @@ func (s *Session) HasTable() bool {
 		return false
 	}
 
-	sql, values := s.dialect.TableExistSQL(table.Name)
-	row := s.Raw(sql, values...).QueryRow()
+	return s.tableExists(table.Name)
+}
+
+func (s *Session) tableExists(name string) bool {
+	sql, values := s.dialect.TableExistSQL(name)
 	var tmp string
-	_ = row.Scan(&tmp)
-	return tmp == table.Name
+	_ = s.Raw(sql, values...).ScanRow(&tmp)
+	return tmp == name
 }
@@ -48,3 +48,57 @@ func TestSessionModel(t *testing.T) {
 		t.Fatal("Failed to change model")
 	}
 }
+
+type Book struct {
+	ID     int    `orm:"primary key;auto increment"`
+	Title  string `orm:"column:title;not null"`
+	Author string `orm:"default:'unknown'"`
+	Cache  string `orm:"-"`
+}
+
+func TestSessionCreateTableWithTags(t *testing.T) {
+	s := NewSession().Model(&Book{})
+	_ = s.DropTable()
+	if err := s.CreateTable(); err != nil {
+		t.Fatal("failed to create table Book", err)
+	}
+	if _, err := s.Insert(&Book{ID: 1, Title: "Go", Author: "Rob", Cache: "x"}); err != nil {
+		t.Fatal("failed to insert into Book", err)
+	}
+
+	var books []Book
+	if err := s.Find(&books); err != nil || len(books) != 1 || books[0].Title != "Go" || books[0].Cache != "" {
+		t.Fatal("failed to query Book", books, err)
+	}
+}
+
+type Order struct {
+	ID     int `orm:"primary key"`
+	Group  string
+	Select int
+}
+
+func TestSessionReservedWords(t *testing.T) {
+	s := NewSession().Model(&Order{})
+	_ = s.DropTable()
+	if err := s.CreateTable(); err != nil || !s.HasTable() {
+		t.Fatal("failed to create table Order", err)
+	}
+	if _, err := s.Insert(&Order{ID: 1, Group: "a", Select: 1}); err != nil {
+		t.Fatal("failed to insert into Order", err)
+	}
+	if _, err := s.Where(`"Group" = ?`, "a").Update("Select", 2); err != nil {
+		t.Fatal("failed to update Order", err)
+	}
+
+	order := &Order{}
+	if err := s.Get(order, 1); err != nil || order.Select != 2 {
+		t.Fatal("failed to query Order", order, err)
+	}
+	if count, err := s.Count(); err != nil || count != 1 {
+		t.Fatal("failed to count Order", err)
+	}
+	if _, err := s.DeleteModel(order); err != nil {
+		t.Fatal("failed to delete Order", err)
+	}
+}
@@ -1,27 +1,103 @@
 package session
 
-import "orm/log"
+import (
+	"errors"
+	"fmt"
 
+	"orm/log"
+)
+
+// Begin starts a transaction, or a savepoint when the session is already in
+// a transaction, so Commit and Rollback only end the innermost unit.
 func (s *Session) Begin() (err error) {
+	if s.tx != nil {
+		name := fmt.Sprintf("sp_%d", s.outerSavepoints+len(s.savepoints)+1)
+		log.Info("savepoint", name)
+		if _, err = s.tx.ExecContext(s.ctx, "SAVEPOINT "+name); err != nil {
+			log.Error(err)
+			return
+		}
+		s.savepoints = append(s.savepoints, name)
+		return
+	}
+
 	log.Info("begin transaction")
-	if s.tx, err = s.db.Begin(); err != nil {
+	if s.tx, err = s.db.BeginTx(s.ctx, s.txOptions); err != nil {
 		log.Error(err)
 	}
 	return
 }
 
 func (s *Session) Commit() (err error) {
+	if s.tx == nil {
+		return errors.New("no transaction to commit")
+	}
+	if n := len(s.savepoints); n > 0 {
+		name := s.savepoints[n-1]
+		log.Info("release savepoint", name)
+		if _, err = s.tx.ExecContext(s.ctx, "RELEASE SAVEPOINT "+name); err != nil {
+			log.Error(err)
+			return
+		}
+		s.savepoints = s.savepoints[:n-1]
+		return
+	}
+
 	log.Info("commit transaction")
-	if err = s.tx.Commit(); err != nil {
+	// the transaction is over even if the commit fails
+	err, s.tx = s.tx.Commit(), nil
+	if err != nil {
 		log.Error(err)
 	}
 	return
 }
 
 func (s *Session) Rollback() (err error) {
+	if s.tx == nil {
+		return errors.New("no transaction to roll back")
+	}
+	if n := len(s.savepoints); n > 0 {
+		name := s.savepoints[n-1]
+		s.savepoints = s.savepoints[:n-1]
+		log.Info("rollback to savepoint", name)
+		if _, err = s.tx.ExecContext(s.ctx, "ROLLBACK TO SAVEPOINT "+name); err != nil {
+			log.Error(err)
+			return
+		}
+		// ROLLBACK TO keeps the savepoint open
+		if _, err = s.tx.ExecContext(s.ctx, "RELEASE SAVEPOINT "+name); err != nil {
+			log.Error(err)
+		}
+		return
+	}
+
 	log.Info("rollback transaction")
-	if err = s.tx.Rollback(); err != nil {
+	err, s.tx = s.tx.Rollback(), nil
+	if err != nil {
 		log.Error(err)
 	}
 	return
 }
+
+// Transaction runs f in a transaction which is committed when f succeeds and
+// rolled back when it fails or panics. Inside another transaction f runs in a
+// savepoint, so service functions can compose their own transactional units.
+func (s *Session) Transaction(f func(*Session) (interface{}, error)) (result interface{}, err error) {
+	if err = s.Begin(); err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			_ = s.Rollback()
+			panic(p)
+		}
+		if err != nil {
+			_ = s.Rollback()
+		} else if err = s.Commit(); err != nil {
+			_ = s.Rollback()
+		}
+	}()
+
+	return f(s)
+}